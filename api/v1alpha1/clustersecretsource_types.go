@@ -0,0 +1,57 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterSecretSourceSpec defines the desired state of ClusterSecretSource
+type ClusterSecretSourceSpec struct {
+	SecretSourceSpec `json:",inline"`
+
+	// NamespaceSelector selects the namespaces where the Secret is generated.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+}
+
+// ClusterSecretSourceStatus defines the observed state of ClusterSecretSource
+type ClusterSecretSourceStatus struct {
+	SecretSourceStatus `json:",inline"`
+
+	// Namespaces are the namespaces where the Secret is generated.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// FailedNamespaces are the namespaces where the Secret could not be generated, with the errors.
+	// +optional
+	FailedNamespaces map[string]string `json:"failedNamespaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="REPOSITORY",type="string",JSONPath=".spec.repository"
+// +kubebuilder:printcolumn:name="PATH",type="string",JSONPath=".spec.path"
+// +kubebuilder:printcolumn:name="COMMIT",type="string",JSONPath=".status.commit",priority=1
+// +kubebuilder:printcolumn:name="LAST SYNC",type="date",JSONPath=".status.lastSyncTime"
+// +kubebuilder:printcolumn:name="ERROR",type="string",JSONPath=".status.error",priority=1
+
+// ClusterSecretSource is the Schema for the clustersecretsources API
+type ClusterSecretSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterSecretSourceSpec   `json:"spec,omitempty"`
+	Status ClusterSecretSourceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterSecretSourceList contains a list of ClusterSecretSource
+type ClusterSecretSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSecretSource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterSecretSource{}, &ClusterSecretSourceList{})
+}
@@ -0,0 +1,218 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretSourceSpec defines the desired state of SecretSource
+type SecretSourceSpec struct {
+	// Provider is the hosting service of the repository.
+	// +kubebuilder:validation:Enum=github;gitlab;git
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// Repository is "owner/repo" for github, "group/project" for gitlab, or the URL for git.
+	// +kubebuilder:validation:MinLength=1
+	Repository string `json:"repository"`
+
+	// Ref is the branch to read. The default branch is read if none of Ref, Tag and Commit is specified.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Tag is the tag to read. It cannot be specified with Ref or Commit.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// Commit is the full SHA of the commit to read. It cannot be specified with Ref or Tag.
+	// +kubebuilder:validation:Pattern=`^([0-9a-f]{40}|[0-9a-f]{64})$`
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Path is the path of the file or the directory in the repository.
+	Path string `json:"path"`
+
+	// Format is the format of the file. It is detected by the extension if it is empty.
+	// +kubebuilder:validation:Enum=yaml;json;toml;dotenv;properties
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// Nested specifies how the nested values in the file are stored.
+	// They are flattened into the keys joined with KeySeparator, or serialized in JSON or YAML.
+	// The nested values are not allowed if it is empty.
+	// +kubebuilder:validation:Enum=flatten;json;yaml
+	// +optional
+	Nested string `json:"nested,omitempty"`
+
+	// KeySeparator is the separator of the flattened keys, and of the relative paths of the files
+	// in the subdirectories when Recursive is set. The default is ".".
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// +optional
+	KeySeparator string `json:"keySeparator,omitempty"`
+
+	// Select is the path expression which selects the map to be injected in the file, e.g. ".apps.billing".
+	// The whole file is injected if it is empty.
+	// +optional
+	Select string `json:"select,omitempty"`
+
+	// Include is the globs of the keys or the file names to be injected. All keys are injected if it is empty.
+	// +optional
+	Include []string `json:"include,omitempty"`
+
+	// Exclude is the globs of the keys or the file names not to be injected.
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+
+	// KeyPrefix is added to the keys except for the renamed keys.
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// +optional
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+
+	// KeySuffix is added to the keys except for the renamed keys.
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// +optional
+	KeySuffix string `json:"keySuffix,omitempty"`
+
+	// Rename maps the new keys to the keys in the source, e.g. {"tls.crt": "server.pem"}.
+	// +optional
+	Rename map[string]string `json:"rename,omitempty"`
+
+	// Recursive reads the files in the subdirectories of the directory as well.
+	// +optional
+	Recursive bool `json:"recursive,omitempty"`
+
+	// Template is the path of the Go template file or the directory of them in the repository.
+	// The templates are rendered against the values of the source, and the outputs are stored under
+	// the names of the templates without the ".tmpl" or ".tpl" extension instead of the values.
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// Sources are the additional sources merged into the Secret in order.
+	// The values of the later sources override the earlier ones unless Conflict is "error".
+	// +optional
+	Sources []SourceRef `json:"sources,omitempty"`
+
+	// Conflict specifies how the keys defined in more than one source are handled.
+	// "override" (default) takes the value of the last source, and "error" fails the sync.
+	// +kubebuilder:validation:Enum=override;error
+	// +optional
+	Conflict string `json:"conflict,omitempty"`
+
+	// Prune removes the keys not in the source from the Secret.
+	// +optional
+	Prune bool `json:"prune,omitempty"`
+
+	// Target is the Secret to be generated.
+	// +optional
+	Target SecretTarget `json:"target,omitempty"`
+}
+
+// SourceRef is an additional source merged into the Secret.
+type SourceRef struct {
+	// Provider is the hosting service of the repository.
+	// +kubebuilder:validation:Enum=github;gitlab;git
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// Repository is "owner/repo" for github, "group/project" for gitlab, or the URL for git.
+	// +kubebuilder:validation:MinLength=1
+	Repository string `json:"repository"`
+
+	// Ref is the branch to read. The default branch is read if none of Ref, Tag and Commit is specified.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Tag is the tag to read. It cannot be specified with Ref or Commit.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// Commit is the full SHA of the commit to read. It cannot be specified with Ref or Tag.
+	// +kubebuilder:validation:Pattern=`^([0-9a-f]{40}|[0-9a-f]{64})$`
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Path is the path of the file or the directory in the repository.
+	Path string `json:"path"`
+
+	// Format is the format of the file. It is detected by the extension if it is empty.
+	// +kubebuilder:validation:Enum=yaml;json;toml;dotenv;properties
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// Select is the path expression which selects the map to be injected in the file.
+	// +optional
+	Select string `json:"select,omitempty"`
+}
+
+// SecretTarget defines the Secret generated from the source.
+type SecretTarget struct {
+	// Name is the name of the Secret. The name of the SecretSource is used if it is empty.
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Type is the type of the Secret.
+	// +optional
+	Type corev1.SecretType `json:"type,omitempty"`
+}
+
+// SecretSourceStatus defines the observed state of SecretSource
+type SecretSourceStatus struct {
+	// ObservedGeneration is the generation of the spec last reconciled.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Commit is the commit SHA the source was last synced from.
+	// +optional
+	Commit string `json:"commit,omitempty"`
+
+	// Ref is the branch or the tag resolved to Commit. It is empty when the source is pinned to a commit.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// SHA is the blob SHA of the source file last synced. It is empty for a directory source.
+	// +optional
+	SHA string `json:"sha,omitempty"`
+
+	// Files are the blob SHAs of the files last synced from a directory source.
+	// +optional
+	Files map[string]string `json:"files,omitempty"`
+
+	// LastSyncTime is the time the source was synced successfully.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Error is the error of the last sync. It is empty if the last sync succeeded.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="REPOSITORY",type="string",JSONPath=".spec.repository"
+// +kubebuilder:printcolumn:name="PATH",type="string",JSONPath=".spec.path"
+// +kubebuilder:printcolumn:name="COMMIT",type="string",JSONPath=".status.commit",priority=1
+// +kubebuilder:printcolumn:name="LAST SYNC",type="date",JSONPath=".status.lastSyncTime"
+// +kubebuilder:printcolumn:name="ERROR",type="string",JSONPath=".status.error",priority=1
+
+// SecretSource is the Schema for the secretsources API
+type SecretSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SecretSourceSpec   `json:"spec,omitempty"`
+	Status SecretSourceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SecretSourceList contains a list of SecretSource
+type SecretSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecretSource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretSource{}, &SecretSourceList{})
+}
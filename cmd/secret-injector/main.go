@@ -1,10 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
+	injectorv1alpha1 "github.com/masa213f/secret-injector/api/v1alpha1"
 	"github.com/masa213f/secret-injector/pkg/injector"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -14,15 +21,80 @@ import (
 )
 
 var (
-	metricsAddr string
-	certDir     string
-	githubToken string
+	scheme = runtime.NewScheme()
+
+	metricsAddr     string
+	certDir         string
+	githubToken     string
+	githubBaseURL   string
+	githubUploadURL string
+	githubCAFile    string
+
+	githubTokenFile      string
+	githubTokenSecret    string
+	githubTokenSecretKey string
+	githubCredentialMap  string
+
+	githubAppIDFile             string
+	githubAppInstallationIDFile string
+	githubAppPrivateKeyFile     string
+
+	policy         string
+	resyncInterval time.Duration
+
+	githubWebhookSecretFile string
+
+	gitlabURL   string
+	gitlabToken string
+	gitCacheDir string
+
+	gitSSHKeyFile        string
+	gitSSHKnownHostsFile string
+
+	requirePinned bool
+
+	signatureGPGKeyring        string
+	signatureSSHAllowedSigners string
+
+	sopsAgeKeyFile string
+	sopsPGPKeyFile string
+	sopsKeySecret  string
+
+	maxSecretSize int
 )
 
 func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = injectorv1alpha1.AddToScheme(scheme)
+
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "listen address for metrics")
 	flag.StringVar(&certDir, "cert-dir", "/certs", "certificate directory")
 	flag.StringVar(&githubToken, "github-token", "", "github token")
+	flag.StringVar(&githubBaseURL, "github-base-url", "", "github enterprise server api url (e.g. https://github.example.com/api/v3/)")
+	flag.StringVar(&githubUploadURL, "github-upload-url", "", "github enterprise server upload url (default: same as --github-base-url)")
+	flag.StringVar(&githubCAFile, "github-ca-file", "", "ca certificates file for github enterprise server")
+	flag.StringVar(&githubTokenFile, "github-token-file", "", "file containing github token (reloaded on change)")
+	flag.StringVar(&githubTokenSecret, "github-token-secret", "", "secret containing github token (namespace/name)")
+	flag.StringVar(&githubTokenSecretKey, "github-token-secret-key", "token", "key of github token in --github-token-secret")
+	flag.StringVar(&githubCredentialMap, "github-credential-map", "", "configmap mapping namespaces and repositories to github tokens (namespace/name)")
+	flag.StringVar(&githubAppIDFile, "github-app-id-file", "", "file containing github app id (enables github app authentication)")
+	flag.StringVar(&githubAppInstallationIDFile, "github-app-installation-id-file", "", "file containing github app installation id (default: looked up from repository owner)")
+	flag.StringVar(&githubAppPrivateKeyFile, "github-app-private-key-file", "", "github app private key file")
+	flag.StringVar(&policy, "policy", "", "configmap declaring the sources each namespace may reference (namespace/name)")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute, "interval to re-fetch the sources of secrets (0 disables the periodic resync)")
+	flag.StringVar(&githubWebhookSecretFile, "github-webhook-secret-file", "", "file containing the secret of github push webhooks (enables /github/push)")
+	flag.StringVar(&gitlabURL, "gitlab-url", "https://gitlab.com/", "gitlab base url")
+	flag.StringVar(&gitlabToken, "gitlab-token", "", "gitlab token")
+	flag.StringVar(&gitCacheDir, "git-cache-dir", "/tmp/secret-injector", "cache directory for git repositories")
+	flag.StringVar(&gitSSHKeyFile, "git-ssh-key-file", "", "ssh private key file for git repositories")
+	flag.StringVar(&gitSSHKnownHostsFile, "git-ssh-known-hosts-file", "", "ssh known_hosts file to verify the host keys of git repositories")
+	flag.BoolVar(&requirePinned, "require-pinned", false, "reject sources which are not pinned to a full commit sha")
+	flag.StringVar(&signatureGPGKeyring, "signature-gpg-keyring", "", "gpg keyring file of the keys trusted to sign commits and tags (enables signature verification)")
+	flag.StringVar(&signatureSSHAllowedSigners, "signature-ssh-allowed-signers", "", "ssh allowed signers file of the keys trusted to sign commits and tags (enables signature verification)")
+	flag.StringVar(&sopsAgeKeyFile, "sops-age-key-file", "", "file containing age identities to decrypt sops files and .age files")
+	flag.StringVar(&sopsPGPKeyFile, "sops-pgp-key-file", "", "file containing armored pgp private keys to decrypt sops files")
+	flag.StringVar(&sopsKeySecret, "sops-key-secret", "", "secret containing *.agekey and *.asc keys to decrypt sops files and .age files (namespace/name)")
+	flag.IntVar(&maxSecretSize, "max-secret-size", 1024*1024, "maximum size in bytes of the data of a secret and of each source file (at most 1048576, the limit of kubernetes)")
 	flag.Parse()
 }
 
@@ -32,6 +104,7 @@ func main() {
 
 	setupLog := log.WithName("setup")
 	mgr, err := manager.New(config.GetConfigOrDie(), manager.Options{
+		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               8443,
 		CertDir:            certDir,
@@ -41,8 +114,85 @@ func main() {
 		os.Exit(1)
 	}
 
+	in, err := injector.New(injector.Config{
+		Client: mgr.GetClient(),
+
+		GitHubToken:     githubToken,
+		GitHubBaseURL:   githubBaseURL,
+		GitHubUploadURL: githubUploadURL,
+		GitHubCAFile:    githubCAFile,
+
+		GitHubTokenFile:      githubTokenFile,
+		GitHubTokenSecret:    githubTokenSecret,
+		GitHubTokenSecretKey: githubTokenSecretKey,
+		GitHubCredentialMap:  githubCredentialMap,
+
+		GitHubAppIDFile:             githubAppIDFile,
+		GitHubAppInstallationIDFile: githubAppInstallationIDFile,
+		GitHubAppPrivateKeyFile:     githubAppPrivateKeyFile,
+
+		Policy: policy,
+
+		GitLabURL:   gitlabURL,
+		GitLabToken: gitlabToken,
+		GitCacheDir: gitCacheDir,
+
+		GitSSHKeyFile:        gitSSHKeyFile,
+		GitSSHKnownHostsFile: gitSSHKnownHostsFile,
+
+		RequirePinned: requirePinned,
+
+		SignatureGPGKeyring:        signatureGPGKeyring,
+		SignatureSSHAllowedSigners: signatureSSHAllowedSigners,
+
+		SOPSAgeKeyFile: sopsAgeKeyFile,
+		SOPSPGPKeyFile: sopsPGPKeyFile,
+		SOPSKeySecret:  sopsKeySecret,
+
+		MaxSecretSize: maxSecretSize,
+	}, log)
+	if err != nil {
+		setupLog.Error(err, "unable to create injector")
+		os.Exit(1)
+	}
+
 	hookServer := mgr.GetWebhookServer()
-	hookServer.Register("/secrets/mutate", &admission.Webhook{Handler: injector.New(githubToken, log)})
+	hookServer.Register("/secrets/mutate", &admission.Webhook{Handler: in})
+
+	err = injector.NewSecretSourceReconciler(mgr.GetClient(), mgr.GetScheme(), in, resyncInterval, log).SetupWithManager(mgr)
+	if err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SecretSource")
+		os.Exit(1)
+	}
+	err = injector.NewClusterSecretSourceReconciler(mgr.GetClient(), mgr.GetScheme(), in, resyncInterval, log).SetupWithManager(mgr)
+	if err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterSecretSource")
+		os.Exit(1)
+	}
+
+	if resyncInterval > 0 || githubWebhookSecretFile != "" {
+		reconciler := injector.NewSecretReconciler(mgr.GetClient(), in, resyncInterval, log)
+		err = reconciler.SetupWithManager(mgr)
+		if err != nil {
+			setupLog.Error(err, "unable to create controller")
+			os.Exit(1)
+		}
+
+		if githubWebhookSecretFile != "" {
+			secret, err := ioutil.ReadFile(githubWebhookSecretFile)
+			if err != nil {
+				setupLog.Error(err, "unable to read github webhook secret")
+				os.Exit(1)
+			}
+			secret = []byte(strings.TrimSpace(string(secret)))
+			// Anyone could sign the payloads with an empty secret.
+			if len(secret) == 0 {
+				setupLog.Error(errors.New("empty secret"), "invalid github webhook secret", "file", githubWebhookSecretFile)
+				os.Exit(1)
+			}
+			hookServer.Register("/github/push", injector.NewPushHandler(mgr.GetClient(), reconciler, secret, log))
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
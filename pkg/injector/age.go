@@ -0,0 +1,35 @@
+package injector
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// The age file format (https://age-encryption.org/v1) is used for the data keys of SOPS
+// and the ".age" files in directory sources.
+
+// ageFileSuffix is the extension of the age encrypted files.
+const ageFileSuffix = ".age"
+
+// parseAgeIdentities parses the identities in the format of age-keygen, "AGE-SECRET-KEY-1...".
+// The empty lines and the comments are ignored.
+func parseAgeIdentities(data []byte) ([]age.Identity, error) {
+	return age.ParseIdentities(bytes.NewReader(data))
+}
+
+// ageDecrypt decrypts the armored or binary age file with any of the identities.
+func ageDecrypt(data []byte, ids []age.Identity) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		r = armor.NewReader(r)
+	}
+	plain, err := age.Decrypt(r, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(plain)
+}
@@ -0,0 +1,45 @@
+package injector
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// readTestData reads the file under testdata.
+func readTestData(t *testing.T, elem ...string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(append([]string{"testdata"}, elem...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// The age files in testdata/sops are encrypted by age 1.2.1 with key.agekey.
+func TestAgeDecrypt(t *testing.T) {
+	ids, err := parseAgeIdentities(readTestData(t, "sops", "key.agekey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	others, err := parseAgeIdentities(readTestData(t, "sops", "other.agekey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := readTestData(t, "sops", "plain.txt")
+
+	for _, file := range []string{"file.txt.age", "file.bin.age"} {
+		plain, err := ageDecrypt(readTestData(t, "sops", file), ids)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if string(plain) != string(expected) {
+			t.Errorf("%s: expected %q, got %q", file, expected, plain)
+		}
+
+		_, err = ageDecrypt(readTestData(t, "sops", file), others)
+		if err == nil {
+			t.Errorf("%s: decrypted with the wrong identity", file)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package injector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	injectorv1alpha1 "github.com/masa213f/secret-injector/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	ctrlsource "sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ClusterSecretSourceReconciler generates the Secrets from ClusterSecretSources in the selected namespaces,
+// and keeps them in sync with the repositories.
+type ClusterSecretSourceReconciler struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	injector *Injector
+	interval time.Duration
+	log      logr.Logger
+}
+
+// NewClusterSecretSourceReconciler creates the new ClusterSecretSourceReconciler which re-fetches the sources every interval.
+// If interval is zero, the sources are fetched only when ClusterSecretSources or namespaces are changed.
+func NewClusterSecretSourceReconciler(c client.Client, scheme *runtime.Scheme, injector *Injector, interval time.Duration, log logr.Logger) *ClusterSecretSourceReconciler {
+	return &ClusterSecretSourceReconciler{
+		client:   c,
+		scheme:   scheme,
+		injector: injector,
+		interval: interval,
+		log:      log.WithName("clustersecretsource"),
+	}
+}
+
+// SetupWithManager registers the reconciler to the manager.
+func (r *ClusterSecretSourceReconciler) SetupWithManager(mgr manager.Manager) error {
+	// Namespaces may start or stop matching the selectors of any ClusterSecretSource.
+	allSources := handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+		sources := &injectorv1alpha1.ClusterSecretSourceList{}
+		err := r.client.List(context.Background(), sources)
+		if err != nil {
+			r.log.Error(err, "Could not list ClusterSecretSources")
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, css := range sources.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: css.Name}})
+		}
+		return requests
+	})
+
+	return builder.ControllerManagedBy(mgr).
+		For(&injectorv1alpha1.ClusterSecretSource{}).
+		Owns(&corev1.Secret{}).
+		Watches(&ctrlsource.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: allSources}).
+		WithEventFilter(predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				// Ignore the status updates made by the reconciler itself.
+				if _, ok := e.ObjectNew.(*injectorv1alpha1.ClusterSecretSource); ok {
+					return e.MetaNew.GetGeneration() != e.MetaOld.GetGeneration()
+				}
+				return true
+			},
+		}).
+		Complete(r)
+}
+
+// Reconcile fetches the source of the ClusterSecretSource, and creates, updates or deletes the Secrets.
+func (r *ClusterSecretSourceReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	log := r.log.WithValues("name", req.Name)
+
+	css := &injectorv1alpha1.ClusterSecretSource{}
+	err := r.client.Get(ctx, req.NamespacedName, css)
+	if apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if css.DeletionTimestamp != nil {
+		return reconcile.Result{}, nil
+	}
+
+	syncErr := r.sync(ctx, css)
+	if syncErr != nil {
+		log.Error(syncErr, "Could not sync ClusterSecretSource")
+		css.Status.Error = syncErr.Error()
+	} else {
+		css.Status.Error = ""
+	}
+	css.Status.ObservedGeneration = css.Generation
+	err = r.client.Status().Update(ctx, css)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if syncErr != nil {
+		return reconcile.Result{}, syncErr
+	}
+	return reconcile.Result{RequeueAfter: r.interval}, nil
+}
+
+// sync updates the Secrets and the status of css except for the error.
+func (r *ClusterSecretSourceReconciler) sync(ctx context.Context, css *injectorv1alpha1.ClusterSecretSource) error {
+	spec := css.Spec
+	selector, err := metav1.LabelSelectorAsSelector(&spec.NamespaceSelector)
+	if err != nil {
+		return err
+	}
+	opt := specOption(&spec.SecretSourceSpec)
+	err = r.injector.validateOption(opt)
+	if err != nil {
+		return err
+	}
+
+	// ClusterSecretSources are managed by the cluster administrators, so the namespace policy is not applied.
+	src, err := r.injector.fetch(ctx, opt, false)
+	if err != nil {
+		return err
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	err = r.client.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return err
+	}
+
+	name := spec.Target.Name
+	if name == "" {
+		name = css.Name
+	}
+	// The errors are collected for each namespace, so that a namespace does not block the others.
+	matched := map[string]bool{}
+	failed := map[string]string{}
+	for _, ns := range namespaces.Items {
+		if ns.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		matched[ns.Name] = true
+		err := r.updateSecret(ctx, css, ns.Name, name, src)
+		if err != nil {
+			failed[ns.Name] = err.Error()
+		}
+	}
+
+	// Clean up the Secrets in the namespaces which no longer match.
+	secrets := &corev1.SecretList{}
+	err = r.client.List(ctx, secrets, client.MatchingLabels{ClusterSecretSourceKey: clusterSecretSourceLabel(css.Name)})
+	if err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		sec := &secrets.Items[i]
+		if matched[sec.Namespace] || !metav1.IsControlledBy(sec, css) {
+			continue
+		}
+		err := r.client.Delete(ctx, sec)
+		if err != nil && !apierrors.IsNotFound(err) {
+			failed[sec.Namespace] = err.Error()
+		}
+	}
+
+	css.Status.Namespaces = make([]string, 0, len(matched))
+	for ns := range matched {
+		if _, ok := failed[ns]; !ok {
+			css.Status.Namespaces = append(css.Status.Namespaces, ns)
+		}
+	}
+	sort.Strings(css.Status.Namespaces)
+	css.Status.FailedNamespaces = nil
+	if len(failed) > 0 {
+		css.Status.FailedNamespaces = failed
+	}
+	css.Status.Commit = src.rev.commit
+	css.Status.Ref = src.rev.ref
+	css.Status.SHA = src.fileHash
+	css.Status.Files = src.dirHash
+	if len(failed) > 0 {
+		failedNamespaces := make([]string, 0, len(failed))
+		for ns := range failed {
+			failedNamespaces = append(failedNamespaces, ns)
+		}
+		sort.Strings(failedNamespaces)
+		return fmt.Errorf("could not sync the Secrets in %s", strings.Join(failedNamespaces, ", "))
+	}
+	now := metav1.Now()
+	css.Status.LastSyncTime = &now
+	return nil
+}
+
+func (r *ClusterSecretSourceReconciler) updateSecret(ctx context.Context, css *injectorv1alpha1.ClusterSecretSource, namespace, name string, src *source) error {
+	spec := css.Spec
+	sec := &corev1.Secret{}
+	sec.Namespace = namespace
+	sec.Name = name
+	_, err := controllerutil.CreateOrUpdate(ctx, r.client, sec, func() error {
+		if sec.CreationTimestamp.IsZero() {
+			sec.Type = spec.Target.Type
+		} else if !metav1.IsControlledBy(sec, css) {
+			return fmt.Errorf("secret %s/%s already exists and is not managed by the ClusterSecretSource", namespace, name)
+		} else if spec.Target.Type != "" && sec.Type != spec.Target.Type {
+			return fmt.Errorf("secret %s/%s has the type %s instead of %s", namespace, name, sec.Type, spec.Target.Type)
+		}
+		if sec.Labels == nil {
+			sec.Labels = map[string]string{}
+		}
+		sec.Labels[ClusterSecretSourceKey] = clusterSecretSourceLabel(css.Name)
+		if sec.Annotations == nil {
+			sec.Annotations = map[string]string{}
+		}
+		sec.Annotations[ClusterSecretSourceNameKey] = css.Name
+		err := r.injector.applySource(sec, src, spec.Prune)
+		if err != nil {
+			return err
+		}
+		return controllerutil.SetControllerReference(css, sec, r.scheme)
+	})
+	return err
+}
+
+// clusterSecretSourceLabel returns the label value for the ClusterSecretSource name.
+// The names can be longer than the 63 characters allowed in the label values, so they are hashed.
+func clusterSecretSourceLabel(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:20])
+}
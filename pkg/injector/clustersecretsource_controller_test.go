@@ -0,0 +1,191 @@
+package injector
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	injectorv1alpha1 "github.com/masa213f/secret-injector/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// testRepository serves the files keyed by the paths at githubTestCommit.
+type testRepository struct {
+	files map[string]string
+}
+
+func (r *testRepository) resolve(ctx context.Context, opt *option) (*revision, error) {
+	return &revision{ref: "refs/heads/main", commit: githubTestCommit}, nil
+}
+
+func (r *testRepository) getContents(ctx context.Context, opt *option, commit, p string) (*blob, []*blob, error) {
+	p = strings.Trim(p, "/")
+	if data, ok := r.files[p]; ok {
+		return &blob{name: path.Base(p), path: p, sha: "blob-" + p, data: []byte(data)}, nil, nil
+	}
+	var dir []*blob
+	for name, data := range r.files {
+		if path.Dir(name) == p {
+			dir = append(dir, &blob{name: path.Base(name), path: name, sha: "blob-" + name, data: []byte(data)})
+		}
+	}
+	if dir == nil {
+		return nil, nil, fmt.Errorf("%s is not found", p)
+	}
+	sort.Slice(dir, func(i, j int) bool { return dir[i].path < dir[j].path })
+	return nil, dir, nil
+}
+
+func newTestInjector(files map[string]string) *Injector {
+	return &Injector{
+		repositories: map[string]repository{providerGitHub: &testRepository{files: files}},
+		maxSize:      maxSecretSize,
+		log:          log.NullLogger{},
+	}
+}
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = injectorv1alpha1.AddToScheme(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func TestClusterSecretSourceReconcilerFailedNamespaces(t *testing.T) {
+	css := &injectorv1alpha1.ClusterSecretSource{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared", UID: "css-uid"},
+		Spec: injectorv1alpha1.ClusterSecretSourceSpec{
+			SecretSourceSpec: injectorv1alpha1.SecretSourceSpec{
+				Repository: "owner/repo",
+				Path:       "secrets.yaml",
+			},
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+		},
+	}
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	// The fake client does not set the creation timestamps.
+	created := metav1.Now()
+	controller := true
+	c := fake.NewFakeClientWithScheme(newTestScheme(t),
+		css,
+		namespace("a1", map[string]string{"team": "a"}),
+		namespace("a2", map[string]string{"team": "a"}),
+		namespace("a3", map[string]string{"team": "a"}),
+		namespace("b", map[string]string{"team": "b"}),
+		// The Secret not managed by the ClusterSecretSource is never overwritten.
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "a2", Name: "shared", CreationTimestamp: created}},
+		// The Secret in the namespace which no longer matches is deleted.
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "b",
+			Name:              "shared",
+			CreationTimestamp: created,
+			Labels:            map[string]string{ClusterSecretSourceKey: clusterSecretSourceLabel(css.Name)},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: injectorv1alpha1.GroupVersion.String(),
+				Kind:       "ClusterSecretSource",
+				Name:       css.Name,
+				UID:        css.UID,
+				Controller: &controller,
+			}},
+		}},
+	)
+	in := newTestInjector(map[string]string{"secrets.yaml": "foo: bar\n"})
+	r := NewClusterSecretSourceReconciler(c, newTestScheme(t), in, 0, log.NullLogger{})
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: css.Name}})
+	if err == nil || !strings.Contains(err.Error(), "a2") {
+		t.Errorf("expected the error in a2, got %v", err)
+	}
+
+	for _, ns := range []string{"a1", "a3"} {
+		sec := &corev1.Secret{}
+		err := c.Get(context.Background(), client.ObjectKey{Namespace: ns, Name: "shared"}, sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(sec.Data["foo"]) != "bar" {
+			t.Errorf("expected the Secret in %s to be generated, got %v", ns, sec.Data)
+		}
+	}
+	unmanaged := &corev1.Secret{}
+	err = c.Get(context.Background(), client.ObjectKey{Namespace: "a2", Name: "shared"}, unmanaged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unmanaged.Data) != 0 {
+		t.Errorf("expected the unmanaged Secret not to be changed, got %v", unmanaged.Data)
+	}
+	err = c.Get(context.Background(), client.ObjectKey{Namespace: "b", Name: "shared"}, &corev1.Secret{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the Secret in b to be deleted, got %v", err)
+	}
+
+	updated := &injectorv1alpha1.ClusterSecretSource{}
+	err = c.Get(context.Background(), client.ObjectKey{Name: css.Name}, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated.Status.Namespaces, []string{"a1", "a3"}) {
+		t.Errorf("expected the namespaces [a1 a3], got %v", updated.Status.Namespaces)
+	}
+	if len(updated.Status.FailedNamespaces) != 1 || !strings.Contains(updated.Status.FailedNamespaces["a2"], "not managed") {
+		t.Errorf("expected a2 to fail, got %v", updated.Status.FailedNamespaces)
+	}
+	if updated.Status.Error == "" || updated.Status.Commit != githubTestCommit {
+		t.Errorf("unexpected status: %+v", updated.Status)
+	}
+}
+
+func TestClusterSecretSourceLongName(t *testing.T) {
+	css := &injectorv1alpha1.ClusterSecretSource{
+		ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("long-name.", 10), UID: "css-uid"},
+		Spec: injectorv1alpha1.ClusterSecretSourceSpec{
+			SecretSourceSpec: injectorv1alpha1.SecretSourceSpec{
+				Repository: "owner/repo",
+				Path:       "secrets.yaml",
+			},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(newTestScheme(t), css, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+	in := newTestInjector(map[string]string{"secrets.yaml": "foo: bar\n"})
+	r := NewClusterSecretSourceReconciler(c, newTestScheme(t), in, 0, log.NullLogger{})
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: css.Name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := &corev1.Secret{}
+	err = c.Get(context.Background(), client.ObjectKey{Namespace: "a", Name: css.Name}, sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	label := sec.Labels[ClusterSecretSourceKey]
+	if errs := validation.IsValidLabelValue(label); len(errs) > 0 {
+		t.Errorf("invalid label value %s: %v", label, errs)
+	}
+	if sec.Annotations[ClusterSecretSourceNameKey] != css.Name {
+		t.Errorf("expected the name %s, got %s", css.Name, sec.Annotations[ClusterSecretSourceNameKey])
+	}
+}
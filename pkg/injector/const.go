@@ -2,18 +2,47 @@ package injector
 
 // Label keys
 const (
-	WebhookTargetKey = "injector.m213f.org/webhook"
+	WebhookTargetKey       = "injector.m213f.org/webhook"
+	ClusterSecretSourceKey = "injector.m213f.org/cluster-secret-source"
+)
+
+// Conflict modes of the sources
+const (
+	conflictOverride = "override"
+	conflictError    = "error"
 )
 
 // Annotation keys
 const (
 	// option
-	RepoNameKey   = "injector.m213f.org/repository"
-	BranchNameKey = "injector.m213f.org/branch"
-	SourcePathKey = "injector.m213f.org/source"
-	PruneFlagKey  = "injector.m213f.org/prune"
+	ProviderKey      = "injector.m213f.org/provider"
+	RepoNameKey      = "injector.m213f.org/repository"
+	BranchNameKey    = "injector.m213f.org/branch"
+	TagNameKey       = "injector.m213f.org/tag"
+	CommitKey        = "injector.m213f.org/commit"
+	SourcePathKey    = "injector.m213f.org/source"
+	FormatKey        = "injector.m213f.org/format"
+	NestedValueKey   = "injector.m213f.org/nested"
+	KeySeparatorKey  = "injector.m213f.org/key-separator"
+	SelectPathKey    = "injector.m213f.org/select"
+	IncludeKey       = "injector.m213f.org/include"
+	ExcludeKey       = "injector.m213f.org/exclude"
+	KeyPrefixKey     = "injector.m213f.org/key-prefix"
+	KeySuffixKey     = "injector.m213f.org/key-suffix"
+	RenameKey        = "injector.m213f.org/rename"
+	RecursiveFlagKey = "injector.m213f.org/recursive"
+	TemplateKey      = "injector.m213f.org/template"
+	SourcesKey       = "injector.m213f.org/sources"
+	ConflictKey      = "injector.m213f.org/conflict"
+	PruneFlagKey     = "injector.m213f.org/prune"
 
 	// status
-	SourceHashKey       = "injector.m213f.org/hash"
-	SourceHashKeyPrefix = "injector.m213f.org/hash_"
+	SourceHashKey         = "injector.m213f.org/hash"
+	SourceHashKeyPrefix   = "injector.m213f.org/hash_"
+	TemplateHashKeyPrefix = "injector.m213f.org/template-hash_"
+	SourceCommitKey       = "injector.m213f.org/resolved-commit"
+	SourceRefKey          = "injector.m213f.org/resolved-ref"
+
+	// ClusterSecretSourceNameKey holds the name of the ClusterSecretSource, whose hash is the value of the ClusterSecretSourceKey label.
+	ClusterSecretSourceNameKey = "injector.m213f.org/cluster-secret-source"
 )
@@ -0,0 +1,132 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	ctrlsource "sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// SecretReconciler keeps the labelled Secrets in sync with the repositories.
+type SecretReconciler struct {
+	client   client.Client
+	injector *Injector
+	interval time.Duration
+	// events triggers the immediate resync of Secrets.
+	events chan event.GenericEvent
+	log    logr.Logger
+}
+
+// NewSecretReconciler creates the new SecretReconciler which re-fetches the sources every interval.
+// If interval is zero, the Secrets are resynced only when they are changed or the resync is triggered.
+func NewSecretReconciler(c client.Client, injector *Injector, interval time.Duration, log logr.Logger) *SecretReconciler {
+	return &SecretReconciler{
+		client:   c,
+		injector: injector,
+		interval: interval,
+		events:   make(chan event.GenericEvent, 100),
+		log:      log.WithName("controller"),
+	}
+}
+
+// resync enqueues the Secret to be resynced immediately.
+func (r *SecretReconciler) resync(ctx context.Context, sec *corev1.Secret) error {
+	select {
+	case r.events <- event.GenericEvent{Meta: sec, Object: sec}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetupWithManager registers the reconciler to the manager.
+func (r *SecretReconciler) SetupWithManager(mgr manager.Manager) error {
+	isTarget := func(labels map[string]string) bool {
+		return labels[WebhookTargetKey] == "true"
+	}
+	return builder.ControllerManagedBy(mgr).
+		For(&corev1.Secret{}).
+		Watches(&ctrlsource.Channel{Source: r.events}, &handler.EnqueueRequestForObject{}).
+		WithEventFilter(predicate.Funcs{
+			CreateFunc:  func(e event.CreateEvent) bool { return isTarget(e.Meta.GetLabels()) },
+			UpdateFunc:  func(e event.UpdateEvent) bool { return isTarget(e.MetaNew.GetLabels()) },
+			DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+			GenericFunc: func(e event.GenericEvent) bool { return isTarget(e.Meta.GetLabels()) },
+		}).
+		Complete(r)
+}
+
+// Reconcile re-fetches the source of the Secret, and updates it when the source is changed.
+func (r *SecretReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	log := r.log.WithValues("namespace", req.Namespace, "name", req.Name)
+
+	sec := &corev1.Secret{}
+	err := r.client.Get(ctx, req.NamespacedName, sec)
+	if apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if sec.Labels[WebhookTargetKey] != "true" || sec.DeletionTimestamp != nil {
+		return reconcile.Result{}, nil
+	}
+
+	opt, err := r.injector.decodeAnnotations(sec)
+	if err != nil {
+		// Wait for the annotations to be fixed.
+		log.Error(err, "Could not decode annotations")
+		return reconcile.Result{}, nil
+	}
+	opt.namespace = sec.Namespace
+
+	updated := sec.DeepCopy()
+	err = r.injector.inject(ctx, updated, opt)
+	var denied *deniedError
+	if errors.As(err, &denied) {
+		log.Info("Denied", "reason", denied.reason)
+		return reconcile.Result{RequeueAfter: r.interval}, nil
+	}
+	if err != nil {
+		log.Error(err, "Could not inject source")
+		return reconcile.Result{}, err
+	}
+
+	if reflect.DeepEqual(sourceHashes(sec), sourceHashes(updated)) {
+		return reconcile.Result{RequeueAfter: r.interval}, nil
+	}
+
+	log.Info("Updating Secret since the source is changed")
+	err = r.client.Update(ctx, updated)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: r.interval}, nil
+}
+
+// sourceHashes returns the hash annotations of the Secret including those of the additional sources, e.g. "hash-1",
+// and those of the templates.
+func sourceHashes(sec *corev1.Secret) map[string]string {
+	hashes := map[string]string{}
+	for k, v := range sec.Annotations {
+		if k == SourceHashKey || strings.HasPrefix(k, SourceHashKeyPrefix) || strings.HasPrefix(k, SourceHashKey+"-") ||
+			strings.HasPrefix(k, TemplateHashKeyPrefix) {
+			hashes[k] = v
+		}
+	}
+	return hashes
+}
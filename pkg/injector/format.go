@@ -0,0 +1,626 @@
+package injector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of the file sources
+const (
+	formatYAML       = "yaml"
+	formatJSON       = "json"
+	formatTOML       = "toml"
+	formatDotenv     = "dotenv"
+	formatProperties = "properties"
+)
+
+var formats = []string{formatYAML, formatJSON, formatTOML, formatDotenv, formatProperties}
+
+// detectFormat returns the format of the file by the extension. The default is YAML.
+func detectFormat(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return formatJSON
+	case ".toml":
+		return formatTOML
+	case ".env":
+		return formatDotenv
+	case ".properties":
+		return formatProperties
+	}
+	return formatYAML
+}
+
+// Representations of the nested values in the file sources
+const (
+	nestedFlatten = "flatten"
+	nestedJSON    = "json"
+	nestedYAML    = "yaml"
+)
+
+var nestedModes = []string{nestedFlatten, nestedJSON, nestedYAML}
+
+// defaultKeySeparator is the separator of the flattened keys.
+const defaultKeySeparator = "."
+
+// parseFile parses the file source in the format.
+// The values are scalars, []interface{} or map[string]interface{}.
+func parseFile(format string, data []byte) (map[string]interface{}, error) {
+	switch format {
+	case formatYAML:
+		m := map[string]yamlValue{}
+		err := yaml.Unmarshal(data, &m)
+		if err != nil {
+			return nil, err
+		}
+		ret := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			ret[k] = v.value
+		}
+		return ret, nil
+	case formatJSON:
+		var v map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err := dec.Decode(&v)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	case formatTOML:
+		return parseTOML(data)
+	case formatDotenv:
+		return interfaceValues(parseDotenv(data))
+	case formatProperties:
+		return interfaceValues(parseProperties(data))
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// parseSelectPath parses the path expression such as ".apps.billing", "$.apps['billing.prod']" and ".items[0]".
+// It returns the keys of the maps as strings and the indices of the lists as ints.
+func parseSelectPath(expr string) ([]interface{}, error) {
+	var segments []interface{}
+	s := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				// Allow "." which selects the whole document.
+				if s == "" && len(segments) == 0 {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("invalid path expression %q: empty key", expr)
+			}
+			segments = append(segments, s[:end])
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path expression %q: unterminated bracket", expr)
+			}
+			if q := s[1]; q == '\'' || q == '"' {
+				key, rest, err := unquoteSelectKey(s[1:], q)
+				if err != nil || !strings.HasPrefix(rest, "]") {
+					return nil, fmt.Errorf("invalid path expression %q: invalid quoted key", expr)
+				}
+				segments = append(segments, key)
+				s = rest[1:]
+				continue
+			}
+			i, err := strconv.Atoi(s[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid path expression %q: invalid index %s", expr, s[1:end])
+			}
+			segments = append(segments, i)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path expression %q", expr)
+		}
+	}
+	return segments, nil
+}
+
+// unquoteSelectKey reads the key quoted by q at the beginning of s, and returns the key and the rest.
+func unquoteSelectKey(s string, q byte) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", errors.New("unterminated key")
+			}
+			b.WriteByte(s[i])
+		case q:
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", errors.New("unterminated key")
+}
+
+// selectValues returns the map selected by the path expression in the parsed file.
+func selectValues(m map[string]interface{}, expr string) (map[string]interface{}, error) {
+	segments, err := parseSelectPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{} = m
+	for i, seg := range segments {
+		switch seg := seg.(type) {
+		case string:
+			mv, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a map", formatSelectPath(segments[:i]))
+			}
+			v, ok = mv[seg]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", formatSelectPath(segments[:i+1]))
+			}
+		case int:
+			lv, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a list", formatSelectPath(segments[:i]))
+			}
+			if seg >= len(lv) {
+				return nil, fmt.Errorf("%s not found", formatSelectPath(segments[:i+1]))
+			}
+			v = lv[seg]
+		}
+	}
+	ret, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a map", formatSelectPath(segments))
+	}
+	return ret, nil
+}
+
+func formatSelectPath(segments []interface{}) string {
+	s := "$"
+	for _, seg := range segments {
+		switch seg := seg.(type) {
+		case string:
+			if seg != "" && !strings.ContainsAny(seg, ".[]'\"\\") {
+				s += "." + seg
+			} else {
+				s += "[" + strconv.Quote(seg) + "]"
+			}
+		case int:
+			s += "[" + strconv.Itoa(seg) + "]"
+		}
+	}
+	return s
+}
+
+// yamlValue decodes the YAML values into scalars, []interface{} or map[string]interface{}.
+type yamlValue struct {
+	value interface{}
+}
+
+func (v *yamlValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if unmarshal(&text) == nil {
+		var value interface{}
+		err := unmarshal(&value)
+		if err != nil {
+			return err
+		}
+		v.value = yamlScalar{text: text, value: value}
+		return nil
+	}
+
+	var l []yamlValue
+	if unmarshal(&l) == nil {
+		values := make([]interface{}, len(l))
+		for i, e := range l {
+			values[i] = e.value
+		}
+		v.value = values
+		return nil
+	}
+
+	var m map[string]yamlValue
+	err := unmarshal(&m)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{}, len(m))
+	for k, e := range m {
+		values[k] = e.value
+	}
+	v.value = values
+	return nil
+}
+
+// yamlScalar keeps the scalar as it is written, so that e.g. "1.50" and "yes" are not reformatted.
+// The decoded value is used when it is serialized again.
+type yamlScalar struct {
+	text  string
+	value interface{}
+}
+
+func (s yamlScalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.value)
+}
+
+func (s yamlScalar) MarshalYAML() (interface{}, error) {
+	return s.value, nil
+}
+
+func interfaceValues(m map[string]string, err error) (map[string]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+// stringValues converts the values into strings. The scalars are stringified, and the nested values
+// are flattened into the keys joined with separator, or serialized in JSON or YAML according to nested.
+// The nested values are not allowed when nested is empty.
+func stringValues(m map[string]interface{}, nested, separator string) (map[string]string, error) {
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		if s, ok := stringScalar(v); ok {
+			// The flattened keys may conflict with the top-level keys, e.g. "a.b" and {"a": {"b": ...}}.
+			if _, ok := ret[k]; ok {
+				return nil, fmt.Errorf("duplicate key after flattening: %s", k)
+			}
+			ret[k] = s
+			continue
+		}
+
+		switch nested {
+		case nestedFlatten:
+			err := flattenValue(ret, k, v, separator)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case nestedJSON:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize %s: %v", k, err)
+			}
+			ret[k] = string(b)
+			continue
+		case nestedYAML:
+			b, err := yaml.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize %s: %v", k, err)
+			}
+			ret[k] = string(b)
+			continue
+		}
+		return nil, fmt.Errorf("value of %s is not a scalar", k)
+	}
+
+	return ret, nil
+}
+
+// flattenValue stores the scalars in v into ret with the keys joined with separator.
+// The elements of the lists are keyed by the indices.
+func flattenValue(ret map[string]string, key string, v interface{}, separator string) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			err := flattenValue(ret, key+separator+k, e, separator)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		for i, e := range v {
+			err := flattenValue(ret, key+separator+strconv.Itoa(i), e, separator)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, ok := stringScalar(v)
+	if !ok {
+		return fmt.Errorf("value of %s is not a scalar", key)
+	}
+	if _, ok := ret[key]; ok {
+		return fmt.Errorf("duplicate key after flattening: %s", key)
+	}
+	ret[key] = s
+	return nil
+}
+
+func stringScalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case yamlScalar:
+		return v.text, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case json.Number:
+		return v.String(), true
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan", true
+		case math.IsInf(v, 1):
+			return "inf", true
+		case math.IsInf(v, -1):
+			return "-inf", true
+		}
+		// Use the same representation as JSON.
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+	return "", false
+}
+
+// parseDotenv parses "KEY=VALUE" lines with an optional "export" prefix.
+// The double quoted values may span multiple lines and may contain escapes (\n, \r, \t, \", \\).
+// The single quoted values are taken literally. The comments start with "#" at the beginning of
+// the lines or after a whitespace in the unquoted values.
+func parseDotenv(data []byte) (map[string]string, error) {
+	ret := map[string]string{}
+	src := strings.Replace(string(data), "\r\n", "\n", -1)
+	line := 1
+	for len(src) > 0 {
+		var l string
+		if i := strings.IndexByte(src, '\n'); i >= 0 {
+			l, src = src[:i], src[i+1:]
+		} else {
+			l, src = src, ""
+		}
+		start := line
+		line++
+
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if strings.HasPrefix(l, "export ") {
+			l = strings.TrimSpace(strings.TrimPrefix(l, "export "))
+		}
+		eq := strings.IndexByte(l, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("dotenv: line %d: invalid line", start)
+		}
+		key := strings.TrimSpace(l[:eq])
+		value := strings.TrimLeft(l[eq+1:], " \t")
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// Join the following lines until the closing quote.
+			value = value[1:]
+			for {
+				end := closingDoubleQuote(value)
+				if end >= 0 {
+					rest := strings.TrimSpace(value[end+1:])
+					if rest != "" && !strings.HasPrefix(rest, "#") {
+						return nil, fmt.Errorf("dotenv: line %d: unexpected characters after the quoted value", start)
+					}
+					value = unescapeDotenv(value[:end])
+					break
+				}
+				if src == "" {
+					return nil, fmt.Errorf("dotenv: line %d: unterminated quoted value", start)
+				}
+				var next string
+				if i := strings.IndexByte(src, '\n'); i >= 0 {
+					next, src = src[:i], src[i+1:]
+				} else {
+					next, src = src, ""
+				}
+				line++
+				value += "\n" + next
+			}
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("dotenv: line %d: unterminated quoted value", start)
+			}
+			value = value[1 : end+1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			if i := strings.Index(value, "\t#"); i >= 0 {
+				value = value[:i]
+			}
+			value = strings.TrimSpace(value)
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
+
+// closingDoubleQuote returns the index of the unescaped double quote in s, or -1.
+func closingDoubleQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '$':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// quoteDotenv returns the double quoted value which parseDotenv reads back as s.
+func quoteDotenv(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '"', '\\', '$':
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// parseProperties parses the Java properties file in the format of java.util.Properties.load.
+func parseProperties(data []byte) (map[string]string, error) {
+	ret := map[string]string{}
+	lines := strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		l := strings.TrimLeft(lines[i], " \t\f")
+		if l == "" || l[0] == '#' || l[0] == '!' {
+			continue
+		}
+		// Join the continuation lines, which end with an odd number of backslashes.
+		for endsWithEscape(l) && i+1 < len(lines) {
+			i++
+			l = l[:len(l)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		if endsWithEscape(l) {
+			l = l[:len(l)-1]
+		}
+
+		// The key ends at the first unescaped "=", ":" or whitespace.
+		end := len(l)
+		for j := 0; j < len(l); j++ {
+			if l[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", l[j]) >= 0 {
+				end = j
+				break
+			}
+		}
+		key, value := l[:end], strings.TrimLeft(l[end:], " \t\f")
+		if value != "" && (value[0] == '=' || value[0] == ':') {
+			value = strings.TrimLeft(value[1:], " \t\f")
+		}
+
+		k, err := unescapeProperties(key)
+		if err != nil {
+			return nil, fmt.Errorf("properties: line %d: %v", i+1, err)
+		}
+		v, err := unescapeProperties(value)
+		if err != nil {
+			return nil, fmt.Errorf("properties: line %d: %v", i+1, err)
+		}
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func endsWithEscape(s string) bool {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func unescapeProperties(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			code, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			r := rune(code)
+			i += 4
+			// Combine the surrogate pairs.
+			if 0xd800 <= r && r < 0xdc00 && i+6 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+				low, err := strconv.ParseUint(s[i+3:i+7], 16, 16)
+				if err == nil && 0xdc00 <= low && low < 0xe000 {
+					r = (r-0xd800)<<10 + (rune(low) - 0xdc00) + 0x10000
+					i += 6
+				}
+			}
+			if !utf8.ValidRune(r) {
+				r = utf8.RuneError
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
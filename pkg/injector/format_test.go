@@ -0,0 +1,298 @@
+package injector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected map[string]string
+		err      string
+	}{
+		{
+			name:     "unquoted",
+			data:     "A=1\nexport B = two words \nC=\n",
+			expected: map[string]string{"A": "1", "B": "two words", "C": ""},
+		},
+		{
+			name:     "comments",
+			data:     "# comment\n\nA=1 # comment\nB=2\t# comment\nC=a#b\n",
+			expected: map[string]string{"A": "1", "B": "2", "C": "a#b"},
+		},
+		{
+			name:     "double quoted",
+			data:     `A="a # b" # comment` + "\n" + `B="\n\r\t\"\\\$\x"` + "\n",
+			expected: map[string]string{"A": "a # b", "B": "\n\r\t\"\\$\\x"},
+		},
+		{
+			name:     "multi-line double quoted",
+			data:     "A=\"line1\nline2\\\"\n\"\r\nB=b\n",
+			expected: map[string]string{"A": "line1\nline2\"\n", "B": "b"},
+		},
+		{
+			name:     "single quoted",
+			data:     `A='a\n"$b" # c'` + "\n",
+			expected: map[string]string{"A": `a\n"$b" # c`},
+		},
+		{name: "no key", data: "=1\n", err: "line 1: invalid line"},
+		{name: "no equal", data: "A=1\nB\n", err: "line 2: invalid line"},
+		{name: "unterminated double quote", data: "A=1\nB=\"b\nc\n", err: "line 2: unterminated"},
+		{name: "unterminated single quote", data: "A='b\n", err: "line 1: unterminated"},
+		{name: "characters after the quote", data: "A=\"a\nb\" c\n", err: "line 1: unexpected characters"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := parseDotenv([]byte(tc.data))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, m)
+			}
+		})
+	}
+}
+
+func TestQuoteDotenv(t *testing.T) {
+	for _, s := range []string{"", "plain", "a\nb\r\n\tc", `"$HOME" \ # x`} {
+		m, err := parseDotenv([]byte("A=" + quoteDotenv(s) + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m["A"] != s {
+			t.Errorf("expected %q, got %q", s, m["A"])
+		}
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected map[string]string
+		err      string
+	}{
+		{
+			name:     "separators",
+			data:     "a=1\nb: 2\nc 3\n  d  =  4  \ne\r\nf=a=b\n",
+			expected: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4  ", "e": "", "f": "a=b"},
+		},
+		{
+			name:     "comments",
+			data:     "# comment\n! comment\n  # comment\n\na=1 # not a comment\n",
+			expected: map[string]string{"a": "1 # not a comment"},
+		},
+		{
+			name:     "escapes",
+			data:     `key\ with\:colon\=eq = tab\there\\back\q\u00e9\ud83d\ude00` + "\n",
+			expected: map[string]string{"key with:colon=eq": "tab\there\\backq\u00e9\U0001f600"},
+		},
+		{
+			name:     "multi-line",
+			data:     "a = first, \\\n    second, \\\r\n    third\nb=2\n",
+			expected: map[string]string{"a": "first, second, third", "b": "2"},
+		},
+		{
+			name:     "escaped backslash at the end",
+			data:     "a=x\\\\\nb=2\n",
+			expected: map[string]string{"a": `x\`, "b": "2"},
+		},
+		{
+			name:     "continuation at the end of the file",
+			data:     "a=x\\",
+			expected: map[string]string{"a": "x"},
+		},
+		{name: "short unicode escape", data: "a=\\u12\n", err: "line 1: invalid unicode escape"},
+		{name: "invalid unicode escape", data: "a=1\\\n2\nb=\\uzzzz\n", err: "line 3: invalid unicode escape"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := parseProperties([]byte(tc.data))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, m)
+			}
+		})
+	}
+}
+
+func TestStringValues(t *testing.T) {
+	testCases := []struct {
+		name      string
+		format    string
+		data      string
+		nested    string
+		separator string
+		expected  map[string]string
+		err       string
+	}{
+		// The scalars are kept as they are written, except for null which is empty.
+		{
+			name:     "scalars",
+			format:   formatYAML,
+			data:     "a: 1.50\nb: yes\nc: ~\nd: text\n",
+			expected: map[string]string{"a": "1.50", "b": "yes", "c": "", "d": "text"},
+		},
+		{
+			name:      "flatten",
+			format:    formatYAML,
+			data:      "a:\n  b: 1\n  c: [x, y]\nd: 1.50\n",
+			nested:    nestedFlatten,
+			separator: ".",
+			expected:  map[string]string{"a.b": "1", "a.c.0": "x", "a.c.1": "y", "d": "1.50"},
+		},
+		{
+			name:      "flatten with a separator",
+			format:    formatJSON,
+			data:      `{"a": {"b": {"c": 1.0}}, "d": [null, true]}`,
+			nested:    nestedFlatten,
+			separator: "__",
+			expected:  map[string]string{"a__b__c": "1.0", "d__0": "", "d__1": "true"},
+		},
+		{
+			name:      "duplicate key after flattening",
+			format:    formatYAML,
+			data:      "a.b: 1\na:\n  b: 2\n",
+			nested:    nestedFlatten,
+			separator: ".",
+			err:       "duplicate key after flattening: a.b",
+		},
+		{
+			name:     "json",
+			format:   formatJSON,
+			data:     `{"a": {"c": [true, null], "b": 1}, "d": "x"}`,
+			nested:   nestedJSON,
+			expected: map[string]string{"a": `{"b":1,"c":[true,null]}`, "d": "x"},
+		},
+		{
+			name:     "json from yaml",
+			format:   formatYAML,
+			data:     "a:\n  b: 1.50\n  c: [yes]\n",
+			nested:   nestedJSON,
+			expected: map[string]string{"a": `{"b":1.5,"c":[true]}`},
+		},
+		{
+			name:     "yaml",
+			format:   formatJSON,
+			data:     `{"a": {"b": "x", "c": [1, 2]}}`,
+			nested:   nestedYAML,
+			expected: map[string]string{"a": "b: x\nc:\n- 1\n- 2\n"},
+		},
+		{
+			name:   "nested value",
+			format: formatYAML,
+			data:   "a:\n  b: 1\n",
+			err:    "value of a is not a scalar",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := parseFile(tc.format, []byte(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := stringValues(parsed, tc.nested, tc.separator)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, m)
+			}
+		})
+	}
+}
+
+func TestSelectValues(t *testing.T) {
+	const data = `
+apps:
+  billing:
+    user: u
+  billing.prod:
+    user: p
+items:
+- name: i0
+- plain
+scalar: s
+`
+	parsed, err := parseFile(formatYAML, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		expr     string
+		expected map[string]string
+		err      string
+	}{
+		{expr: ".apps.billing", expected: map[string]string{"user": "u"}},
+		{expr: "$.apps['billing.prod']", expected: map[string]string{"user": "p"}},
+		{expr: `.apps["billing.prod"]`, expected: map[string]string{"user": "p"}},
+		{expr: ".items[0]", expected: map[string]string{"name": "i0"}},
+		{expr: ".scalar.x", err: "$.scalar is not a map"},
+		{expr: ".items[1]", err: "$.items[1] is not a map"},
+		{expr: ".scalar", err: "$.scalar is not a map"},
+		{expr: ".apps[0]", err: "$.apps is not a list"},
+		{expr: ".apps['billing.prod'].user.x", err: `$.apps["billing.prod"].user is not a map`},
+		{expr: ".missing", err: "$.missing not found"},
+		{expr: ".items[5]", err: "$.items[5] not found"},
+		{expr: "apps", err: "invalid path expression"},
+		{expr: ".apps..billing", err: "empty key"},
+		{expr: ".apps[0", err: "unterminated bracket"},
+		{expr: ".apps['billing]", err: "invalid quoted key"},
+		{expr: ".items[x]", err: "invalid index"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			selected, err := selectValues(parsed, tc.expr)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := stringValues(selected, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, m)
+			}
+		})
+	}
+
+	// "." selects the whole document.
+	selected, err := selectValues(parsed, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(selected, parsed) {
+		t.Errorf("expected the whole document, got %v", selected)
+	}
+}
@@ -0,0 +1,298 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// gitRepository reads the contents from an arbitrary Git repository.
+// It fetches the requested ref into a local bare repository using the git command.
+type gitRepository struct {
+	cacheDir string
+	// allowFile allows the local repositories, which is used only in the tests.
+	// Otherwise any namespace could read the repositories on the file system including the cache of the other URLs.
+	allowFile bool
+	// sshCommand is GIT_SSH_COMMAND.
+	sshCommand string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// newGitRepository creates the gitRepository. sshKeyFile and sshKnownHostsFile are used for the SSH URLs.
+func newGitRepository(cacheDir, sshKeyFile, sshKnownHostsFile string) *gitRepository {
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "secret-injector")
+	}
+	return &gitRepository{
+		cacheDir:   cacheDir,
+		sshCommand: gitSSHCommand(sshKeyFile, sshKnownHostsFile),
+		locks:      map[string]*sync.Mutex{},
+	}
+}
+
+// gitSSHCommand returns the ssh command which never prompts and always verifies the host keys.
+// It does not depend on the home directory, which the container user does not have.
+func gitSSHCommand(keyFile, knownHostsFile string) string {
+	args := []string{"ssh", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes"}
+	if keyFile != "" {
+		args = append(args, "-o", "IdentitiesOnly=yes", "-i", shellQuote(keyFile))
+	}
+	if knownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+shellQuote(knownHostsFile))
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes s for GIT_SSH_COMMAND, which is run by the shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func (r *gitRepository) resolve(ctx context.Context, opt *option) (*revision, error) {
+	ref := opt.ref()
+	refspec := ref
+	switch {
+	case opt.commit != "":
+		refspec = opt.commit
+	case ref == "":
+		refspec = "HEAD"
+	}
+	commit, object, err := r.fetch(ctx, opt.repository, refspec)
+	if err != nil {
+		return nil, err
+	}
+	rev := &revision{ref: ref, commit: commit}
+	if object != commit {
+		rev.tag = object
+	}
+	return rev, nil
+}
+
+func (r *gitRepository) readSigned(ctx context.Context, opt *option, objType, sha string) (*signedObject, error) {
+	raw, err := r.git(ctx, r.cachePath(opt.repository), "cat-file", objType, sha)
+	if err != nil {
+		return nil, err
+	}
+	if objType == "tag" {
+		return splitTagSignature(raw), nil
+	}
+	return splitCommitSignature(raw), nil
+}
+
+func (r *gitRepository) getContents(ctx context.Context, opt *option, commit, p string) (*blob, []*blob, error) {
+	dir := r.cachePath(opt.repository)
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		files, err := r.listDir(ctx, dir, commit, "", opt.recursive)
+		return nil, files, err
+	}
+	entries, err := r.lsTree(ctx, dir, commit, p, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) != 1 {
+		return nil, nil, fmt.Errorf("git: %s not found in %s", p, opt.repository)
+	}
+
+	switch entries[0].objType {
+	case "blob":
+		if entries[0].mode == gitModeSymlink {
+			return nil, nil, fmt.Errorf("git: %s is a symbolic link", p)
+		}
+		file, err := r.readBlob(ctx, dir, entries[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, nil, nil
+	case "tree":
+		files, err := r.listDir(ctx, dir, commit, p+"/", opt.recursive)
+		return nil, files, err
+	}
+	return nil, nil, fmt.Errorf("git: %s is not a file or directory", p)
+}
+
+func (r *gitRepository) listDir(ctx context.Context, dir, commit, prefix string, recursive bool) ([]*blob, error) {
+	entries, err := r.lsTree(ctx, dir, commit, prefix, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*blob
+	for _, entry := range entries {
+		// Skip the symbolic links as the GitHub provider does. Their blobs are the link targets.
+		if entry.objType != "blob" || entry.mode == gitModeSymlink {
+			continue
+		}
+		file, err := r.readBlob(ctx, dir, entry)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// lfsEndpoint returns the LFS server at the default location of the HTTP(S) repository.
+// The credentials in the URL are used for the batch API.
+func (r *gitRepository) lfsEndpoint(ctx context.Context, opt *option) (*lfsEndpoint, error) {
+	u := opt.repository
+	if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		return nil, fmt.Errorf("git: Git LFS is supported only for HTTP(S) repositories: %s", u)
+	}
+	u = strings.TrimSuffix(u, "/")
+	if !strings.HasSuffix(u, ".git") {
+		u += ".git"
+	}
+	return &lfsEndpoint{
+		url:    u + "/info/lfs",
+		client: http.DefaultClient,
+	}, nil
+}
+
+// cachePath returns the path of the local bare repository for url.
+func (r *gitRepository) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(r.cacheDir, hex.EncodeToString(sum[:]))
+}
+
+// fetch fetches ref from url into the cache, and returns the fetched commit and the object ref points to.
+// The object differs from the commit when ref is an annotated tag.
+func (r *gitRepository) fetch(ctx context.Context, url, ref string) (string, string, error) {
+	if url == "" || strings.HasPrefix(url, "-") {
+		return "", "", errors.New("git: invalid repository url: " + url)
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", "", errors.New("git: invalid ref: " + ref)
+	}
+	dir := r.cachePath(url)
+
+	// Serialize the fetches for the same repository, since FETCH_HEAD is shared.
+	r.mu.Lock()
+	lock, ok := r.locks[dir]
+	if !ok {
+		lock = &sync.Mutex{}
+		r.locks[dir] = lock
+	}
+	r.mu.Unlock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); os.IsNotExist(err) {
+		_, err := r.git(ctx, "", "init", "--quiet", "--bare", dir)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	_, err := r.git(ctx, dir, "fetch", "--quiet", "--force", "--no-tags", url, ref)
+	if err != nil {
+		return "", "", err
+	}
+	out, err := r.git(ctx, dir, "rev-parse", "FETCH_HEAD^{commit}", "FETCH_HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	shas := strings.Fields(string(out))
+	if len(shas) != 2 {
+		return "", "", fmt.Errorf("git: unexpected rev-parse output: %q", out)
+	}
+	return shas[0], shas[1], nil
+}
+
+// gitModeSymlink is the mode of the symbolic links in the trees.
+const gitModeSymlink = "120000"
+
+type gitTreeEntry struct {
+	mode    string
+	objType string
+	sha     string
+	path    string
+}
+
+func (r *gitRepository) lsTree(ctx context.Context, dir, commit, p string, recursive bool) ([]gitTreeEntry, error) {
+	args := []string{"ls-tree", "-z"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, commit)
+	if p != "" {
+		args = append(args, "--", p)
+	}
+	out, err := r.git(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []gitTreeEntry
+	for _, line := range strings.Split(string(out), "\x00") {
+		if line == "" {
+			continue
+		}
+		// <mode> SP <type> SP <object> TAB <file>
+		tab := strings.IndexByte(line, '\t')
+		if tab < 0 {
+			return nil, fmt.Errorf("git: unexpected ls-tree output: %q", line)
+		}
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("git: unexpected ls-tree output: %q", line)
+		}
+		entries = append(entries, gitTreeEntry{
+			mode:    fields[0],
+			objType: fields[1],
+			sha:     fields[2],
+			path:    line[tab+1:],
+		})
+	}
+	return entries, nil
+}
+
+func (r *gitRepository) readBlob(ctx context.Context, dir string, entry gitTreeEntry) (*blob, error) {
+	data, err := r.git(ctx, dir, "cat-file", "blob", entry.sha)
+	if err != nil {
+		return nil, err
+	}
+	return &blob{
+		name: path.Base(entry.path),
+		path: entry.path,
+		sha:  entry.sha,
+		data: data,
+	}, nil
+}
+
+func (r *gitRepository) git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	subcommand := args[0]
+	if dir != "" {
+		args = append([]string{"--git-dir", dir}, args...)
+	}
+	// Restrict the transports for the user supplied URLs.
+	protocols := "https:http:ssh:git"
+	if r.allowFile {
+		protocols += ":file"
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ALLOW_PROTOCOL="+protocols,
+		"GIT_SSH_COMMAND="+r.sshCommand,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", subcommand, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
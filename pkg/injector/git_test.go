@@ -0,0 +1,183 @@
+package injector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newGitTestRepository creates a bare repository with the branch main, the annotated tag v1 at the first commit,
+// and the second commit adding d/x, d/sub/y and the symbolic links d/link and link.yaml.
+// It returns the path of the bare repository.
+func newGitTestRepository(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	bare := filepath.Join(root, "repo.git")
+	work := filepath.Join(root, "work")
+	runGit(t, root, "init", "--quiet", "--bare", bare)
+	runGit(t, bare, "symbolic-ref", "HEAD", "refs/heads/main")
+	runGit(t, root, "init", "--quiet", work)
+	runGit(t, work, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	write := func(name, content string) {
+		p := filepath.Join(work, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("f.yaml", "foo: bar\n")
+	runGit(t, work, "add", "-A")
+	runGit(t, work, "commit", "--quiet", "-m", "first")
+	runGit(t, work, "tag", "-a", "-m", "v1", "v1")
+	write("d/x", "x")
+	write("d/sub/y", "y")
+	if err := os.Symlink("x", filepath.Join(work, "d/link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(work, "link.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, work, "add", "-A")
+	runGit(t, work, "commit", "--quiet", "-m", "second")
+	runGit(t, work, "push", "--quiet", bare, "main", "v1")
+	return bare
+}
+
+func TestGitResolve(t *testing.T) {
+	bare := newGitTestRepository(t)
+	head := runGit(t, bare, "rev-parse", "main")
+	first := runGit(t, bare, "rev-parse", "v1^{commit}")
+	tag := runGit(t, bare, "rev-parse", "v1")
+
+	r := newGitRepository(t.TempDir(), "", "")
+	r.allowFile = true
+	testCases := []struct {
+		name     string
+		opt      *option
+		expected *revision
+	}{
+		{
+			name:     "default branch",
+			opt:      &option{},
+			expected: &revision{commit: head},
+		},
+		{
+			name:     "branch",
+			opt:      &option{branch: "main"},
+			expected: &revision{ref: "refs/heads/main", commit: head},
+		},
+		{
+			name:     "annotated tag",
+			opt:      &option{tag: "v1"},
+			expected: &revision{ref: "refs/tags/v1", commit: first, tag: tag},
+		},
+		{
+			name:     "commit",
+			opt:      &option{commit: first},
+			expected: &revision{commit: first},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opt.repository = bare
+			rev, err := r.resolve(context.Background(), tc.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rev, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, rev)
+			}
+		})
+	}
+
+	_, err := r.resolve(context.Background(), &option{repository: bare, branch: "missing"})
+	if err == nil {
+		t.Error("resolved a missing branch")
+	}
+}
+
+func TestGitGetContents(t *testing.T) {
+	bare := newGitTestRepository(t)
+	head := runGit(t, bare, "rev-parse", "main")
+
+	r := newGitRepository(t.TempDir(), "", "")
+	r.allowFile = true
+	opt := &option{repository: bare}
+	_, err := r.resolve(context.Background(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, _, err := r.getContents(context.Background(), opt, head, "/f.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &blob{name: "f.yaml", path: "f.yaml", sha: runGit(t, bare, "rev-parse", head+":f.yaml"), data: []byte("foo: bar\n")}
+	if !reflect.DeepEqual(file, expected) {
+		t.Errorf("expected %+v, got %+v", expected, file)
+	}
+
+	x := &blob{name: "x", path: "d/x", sha: runGit(t, bare, "rev-parse", head+":d/x"), data: []byte("x")}
+	y := &blob{name: "y", path: "d/sub/y", sha: runGit(t, bare, "rev-parse", head+":d/sub/y"), data: []byte("y")}
+	_, dir, err := r.getContents(context.Background(), opt, head, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dir, []*blob{x}) {
+		t.Errorf("expected only d/x, got %+v", dir)
+	}
+	opt.recursive = true
+	_, dir, err = r.getContents(context.Background(), opt, head, "d/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dir, []*blob{y, x}) {
+		t.Errorf("expected d/sub/y and d/x, got %+v", dir)
+	}
+
+	_, _, err = r.getContents(context.Background(), opt, head, "missing")
+	if err == nil {
+		t.Error("read a missing file")
+	}
+	_, _, err = r.getContents(context.Background(), opt, head, "link.yaml")
+	if err == nil || !strings.Contains(err.Error(), "symbolic link") {
+		t.Errorf("expected the symbolic link to be rejected, got %v", err)
+	}
+}
+
+func TestGitDisallowsLocalRepositories(t *testing.T) {
+	bare := newGitTestRepository(t)
+	r := newGitRepository(t.TempDir(), "", "")
+	for _, url := range []string{bare, "file://" + bare} {
+		_, err := r.resolve(context.Background(), &option{repository: url})
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("expected the local repository %s to be disallowed, got %v", url, err)
+		}
+	}
+}
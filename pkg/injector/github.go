@@ -0,0 +1,359 @@
+package injector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v30/github"
+	"golang.org/x/oauth2"
+)
+
+// githubCredential provides the token to access a repository.
+type githubCredential interface {
+	// tokenSource returns the token source for the repository specified by opt.
+	// It returns nil when the repository should be accessed anonymously.
+	tokenSource(ctx context.Context, opt *option) (oauth2.TokenSource, error)
+}
+
+// staticGitHubCredential is a credential with a fixed token such as a personal access token.
+type staticGitHubCredential struct {
+	ts oauth2.TokenSource
+}
+
+func newStaticGitHubCredential(token string) *staticGitHubCredential {
+	if token == "" {
+		return &staticGitHubCredential{}
+	}
+	return &staticGitHubCredential{
+		ts: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}),
+	}
+}
+
+func (c *staticGitHubCredential) tokenSource(ctx context.Context, opt *option) (oauth2.TokenSource, error) {
+	return c.ts, nil
+}
+
+// githubClientFactory creates GitHub API clients for github.com or GitHub Enterprise Server.
+type githubClientFactory struct {
+	httpClient *http.Client
+	baseURL    string
+	uploadURL  string
+}
+
+func newGitHubClientFactory(httpClient *http.Client, baseURL, uploadURL string) (*githubClientFactory, error) {
+	if uploadURL == "" {
+		uploadURL = baseURL
+	}
+	f := &githubClientFactory{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		uploadURL:  uploadURL,
+	}
+	// Validate the URLs in advance.
+	_, err := f.newClient(nil)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// newClient creates a client which authenticates with ts.
+func (f *githubClientFactory) newClient(ts oauth2.TokenSource) (*github.Client, error) {
+	c := f.httpClient
+	if ts != nil {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, f.httpClient)
+		c = oauth2.NewClient(ctx, ts)
+	}
+	if f.baseURL == "" {
+		return github.NewClient(c), nil
+	}
+	// GitHub Enterprise Server
+	return github.NewEnterpriseClient(f.baseURL, f.uploadURL, c)
+}
+
+// webURL returns the URL of the web server, e.g. "https://github.com/" for "https://api.github.com/".
+func (f *githubClientFactory) webURL() string {
+	c, _ := f.newClient(nil)
+	u := *c.BaseURL
+	if u.Host == "api.github.com" {
+		return "https://github.com/"
+	}
+	// GitHub Enterprise Server serves the API under /api/v3/.
+	u.Path = strings.TrimSuffix(u.Path, "api/v3/")
+	return u.String()
+}
+
+type githubRepository struct {
+	clients    *githubClientFactory
+	credential githubCredential
+	// maxSize is the maximum size of the files. The larger files are rejected without being downloaded.
+	maxSize int
+}
+
+func newGitHubRepository(clients *githubClientFactory, credential githubCredential, maxSize int) *githubRepository {
+	return &githubRepository{
+		clients:    clients,
+		credential: credential,
+		maxSize:    maxSize,
+	}
+}
+
+func (r *githubRepository) client(ctx context.Context, opt *option) (*github.Client, error) {
+	ts, err := r.credential.tokenSource(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	return r.clients.newClient(ts)
+}
+
+func (r *githubRepository) resolve(ctx context.Context, opt *option) (*revision, error) {
+	client, err := r.client(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.commit != "" {
+		sha, _, err := client.Repositories.GetCommitSHA1(ctx, opt.owner, opt.repo, opt.commit, "")
+		if err != nil {
+			return nil, err
+		}
+		return &revision{commit: sha}, nil
+	}
+
+	ref := opt.ref()
+	if ref == "" {
+		repo, _, err := client.Repositories.Get(ctx, opt.owner, opt.repo)
+		if err != nil {
+			return nil, err
+		}
+		ref = "refs/heads/" + repo.GetDefaultBranch()
+	}
+	reference, _, err := client.Git.GetRef(ctx, opt.owner, opt.repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	rev := &revision{ref: ref}
+	obj := reference.GetObject()
+	if obj.GetType() == "tag" {
+		rev.tag = obj.GetSHA()
+	}
+	// Peel annotated tags.
+	for obj.GetType() == "tag" {
+		tag, _, err := client.Git.GetTag(ctx, opt.owner, opt.repo, obj.GetSHA())
+		if err != nil {
+			return nil, err
+		}
+		obj = tag.GetObject()
+	}
+	if obj.GetType() != "commit" {
+		return nil, fmt.Errorf("%s does not point to a commit", ref)
+	}
+	rev.commit = obj.GetSHA()
+	return rev, nil
+}
+
+func (r *githubRepository) readSigned(ctx context.Context, opt *option, objType, sha string) (*signedObject, error) {
+	client, err := r.client(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var verification *github.SignatureVerification
+	switch objType {
+	case "commit":
+		commit, _, err := client.Git.GetCommit(ctx, opt.owner, opt.repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		verification = commit.GetVerification()
+	case "tag":
+		tag, _, err := client.Git.GetTag(ctx, opt.owner, opt.repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		verification = tag.GetVerification()
+	default:
+		return nil, fmt.Errorf("unknown object type: %s", objType)
+	}
+	// The signature is verified with the trusted keys rather than trusting the result of GitHub.
+	return &signedObject{
+		payload:   []byte(verification.GetPayload()),
+		signature: []byte(verification.GetSignature()),
+	}, nil
+}
+
+func (r *githubRepository) getContents(ctx context.Context, opt *option, commit, path string) (*blob, []*blob, error) {
+	client, err := r.client(ctx, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileContent, dirContent, _, err := client.Repositories.GetContents(
+		ctx, opt.owner, opt.repo, path, &github.RepositoryContentGetOptions{Ref: commit})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if fileContent != nil {
+		err = r.checkSize(fileContent.GetPath(), fileContent.GetSize())
+		if err != nil {
+			return nil, nil, err
+		}
+		// The contents API does not return the content of the files larger than 1 MB.
+		if fileContent.GetEncoding() == "none" || fileContent.Content == nil && fileContent.GetSize() > 0 {
+			file, err := r.readBlob(ctx, client, opt, fileContent.GetPath(), fileContent.GetSHA())
+			if err != nil {
+				return nil, nil, err
+			}
+			return file, nil, nil
+		}
+		file, err := toBlob(fileContent)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, nil, nil
+	}
+
+	var entries []githubTreeEntry
+	if opt.recursive {
+		entries, err = r.listTree(ctx, client, opt, commit, path)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		for _, fileMeta := range dirContent {
+			if fileMeta.Type == nil || *fileMeta.Type == "file" {
+				entries = append(entries, githubTreeEntry{path: fileMeta.GetPath(), sha: fileMeta.GetSHA(), size: fileMeta.GetSize()})
+			}
+		}
+	}
+
+	// The files are read with the blobs API, which serves the files up to 100 MB unlike the contents API.
+	var files []*blob
+	for _, entry := range entries {
+		err = r.checkSize(entry.path, entry.size)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, entry := range entries {
+		file, err := r.readBlob(ctx, client, opt, entry.path, entry.sha)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, file)
+	}
+	return nil, files, nil
+}
+
+type githubTreeEntry struct {
+	path string
+	sha  string
+	size int
+}
+
+// checkSize returns an error if the file at p is larger than the maximum size.
+func (r *githubRepository) checkSize(p string, size int) error {
+	if size > r.maxSize {
+		return fmt.Errorf("%s is %d bytes, which exceeds the maximum size %d bytes", p, size, r.maxSize)
+	}
+	return nil
+}
+
+// listTree returns the files under the directory including the subdirectories.
+// It resolves the tree of the directory level by level, and reads only the subtree recursively.
+func (r *githubRepository) listTree(ctx context.Context, client *github.Client, opt *option, commit, dir string) ([]githubTreeEntry, error) {
+	dir = strings.Trim(dir, "/")
+	sha := commit
+	if dir != "" {
+		for _, name := range strings.Split(dir, "/") {
+			tree, _, err := client.Git.GetTree(ctx, opt.owner, opt.repo, sha, false)
+			if err != nil {
+				return nil, err
+			}
+			sha = ""
+			for _, entry := range tree.Entries {
+				if entry.GetPath() == name && entry.GetType() == "tree" {
+					sha = entry.GetSHA()
+					break
+				}
+			}
+			if sha == "" {
+				return nil, fmt.Errorf("%s is not found in %s", dir, opt.repository)
+			}
+		}
+	}
+
+	tree, _, err := client.Git.GetTree(ctx, opt.owner, opt.repo, sha, true)
+	if err != nil {
+		return nil, err
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("the tree of %s in %s is too large to read recursively", dir, opt.repository)
+	}
+
+	var entries []githubTreeEntry
+	for _, entry := range tree.Entries {
+		// Skip the symbolic links as the contents API does.
+		if entry.GetType() != "blob" || entry.GetMode() == "120000" {
+			continue
+		}
+		// The paths are relative to the directory.
+		p := path.Join(dir, entry.GetPath())
+		entries = append(entries, githubTreeEntry{path: p, sha: entry.GetSHA(), size: entry.GetSize()})
+	}
+	return entries, nil
+}
+
+// readBlob reads the file at p by the blob SHA.
+func (r *githubRepository) readBlob(ctx context.Context, client *github.Client, opt *option, p, sha string) (*blob, error) {
+	data, _, err := client.Git.GetBlobRaw(ctx, opt.owner, opt.repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	return &blob{
+		name: path.Base(p),
+		path: p,
+		sha:  sha,
+		data: data,
+	}, nil
+}
+
+func (r *githubRepository) lfsEndpoint(ctx context.Context, opt *option) (*lfsEndpoint, error) {
+	ts, err := r.credential.tokenSource(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	ep := &lfsEndpoint{
+		url:      r.clients.webURL() + opt.owner + "/" + opt.repo + ".git/info/lfs",
+		client:   r.clients.httpClient,
+		username: "x-access-token",
+	}
+	if ep.client == nil {
+		ep.client = http.DefaultClient
+	}
+	if ts != nil {
+		token, err := ts.Token()
+		if err != nil {
+			return nil, err
+		}
+		ep.password = token.AccessToken
+	}
+	return ep, nil
+}
+
+func toBlob(content *github.RepositoryContent) (*blob, error) {
+	str, err := content.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return &blob{
+		name: content.GetName(),
+		path: content.GetPath(),
+		sha:  content.GetSHA(),
+		data: []byte(str),
+	}, nil
+}
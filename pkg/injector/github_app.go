@@ -0,0 +1,211 @@
+package injector
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GitHub accepts JWTs which expire within 10 minutes.
+	githubAppJWTLifetime = 9 * time.Minute
+	// Installation tokens are valid for an hour. They are refreshed a while before the expiry.
+	githubAppTokenRefreshMargin = 5 * time.Minute
+)
+
+// githubAppCredential authenticates as a GitHub App installation.
+type githubAppCredential struct {
+	clients        *githubClientFactory
+	appID          int64
+	installationID int64
+	appTokens      oauth2.TokenSource
+
+	mu sync.Mutex
+	// installation token sources keyed by the installation ID
+	installations map[int64]oauth2.TokenSource
+	// installation IDs keyed by the owner of repositories
+	owners map[string]int64
+}
+
+// newGitHubAppCredentialFromFiles creates githubAppCredential.
+// installationIDFile may be empty. In that case, the installation is looked up from the owner of the repository.
+func newGitHubAppCredentialFromFiles(clients *githubClientFactory, appIDFile, installationIDFile, privateKeyFile string) (*githubAppCredential, error) {
+	appID, err := readIDFile(appIDFile)
+	if err != nil {
+		return nil, err
+	}
+	var installationID int64
+	if installationIDFile != "" {
+		installationID, err = readIDFile(installationIDFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pemData, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseRSAPrivateKey(pemData)
+	if err != nil {
+		return nil, err
+	}
+	return newGitHubAppCredential(clients, appID, installationID, key), nil
+}
+
+func newGitHubAppCredential(clients *githubClientFactory, appID, installationID int64, key *rsa.PrivateKey) *githubAppCredential {
+	return &githubAppCredential{
+		clients:        clients,
+		appID:          appID,
+		installationID: installationID,
+		appTokens:      oauth2.ReuseTokenSource(nil, &githubAppJWTSource{appID: appID, key: key}),
+		installations:  map[int64]oauth2.TokenSource{},
+		owners:         map[string]int64{},
+	}
+}
+
+func (c *githubAppCredential) tokenSource(ctx context.Context, opt *option) (oauth2.TokenSource, error) {
+	id, err := c.lookupInstallation(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts, ok := c.installations[id]
+	if !ok {
+		ts = oauth2.ReuseTokenSource(nil, &githubInstallationTokenSource{credential: c, installationID: id})
+		c.installations[id] = ts
+	}
+	return ts, nil
+}
+
+func (c *githubAppCredential) lookupInstallation(ctx context.Context, opt *option) (int64, error) {
+	if c.installationID != 0 {
+		return c.installationID, nil
+	}
+
+	c.mu.Lock()
+	id, ok := c.owners[opt.owner]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	client, err := c.clients.newClient(c.appTokens)
+	if err != nil {
+		return 0, err
+	}
+	inst, _, err := client.Apps.FindRepositoryInstallation(ctx, opt.owner, opt.repo)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.owners[opt.owner] = inst.GetID()
+	c.mu.Unlock()
+	return inst.GetID(), nil
+}
+
+// githubInstallationTokenSource mints installation access tokens.
+type githubInstallationTokenSource struct {
+	credential     *githubAppCredential
+	installationID int64
+}
+
+func (s *githubInstallationTokenSource) Token() (*oauth2.Token, error) {
+	client, err := s.credential.clients.newClient(s.credential.appTokens)
+	if err != nil {
+		return nil, err
+	}
+	token, _, err := client.Apps.CreateInstallationToken(context.Background(), s.installationID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt().Add(-githubAppTokenRefreshMargin),
+	}, nil
+}
+
+// githubAppJWTSource issues JWTs to authenticate as a GitHub App.
+type githubAppJWTSource struct {
+	appID int64
+	key   *rsa.PrivateKey
+}
+
+func (s *githubAppJWTSource) Token() (*oauth2.Token, error) {
+	// Issue the token a bit in the past to allow for clock drift.
+	now := time.Now().Add(-time.Minute)
+	exp := now.Add(githubAppJWTLifetime)
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return nil, err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Unix(),
+		"exp": exp.Unix(),
+		"iss": s.appID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: unsigned + "." + base64.RawURLEncoding.EncodeToString(sig),
+		TokenType:   "Bearer",
+		Expiry:      exp.Add(-time.Minute),
+	}, nil
+}
+
+func readIDFile(filename string) (int64, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid id in " + filename)
+	}
+	return id, nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data is found in the private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the private key is not a RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,289 @@
+package injector
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// githubAppTestServer serves the GitHub App endpoints. The installation of the owner "owner-N" is N,
+// and the installation tokens are "token-N-M" for the M-th token of the installation N.
+type githubAppTestServer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// tokenLifetime is the lifetime of the installation tokens.
+	tokenLifetime time.Duration
+
+	mu      sync.Mutex
+	lookups []string
+	tokens  map[string]int
+}
+
+func newGitHubAppTestServer(t *testing.T, key *rsa.PrivateKey, tokenLifetime time.Duration) *githubAppTestServer {
+	s := &githubAppTestServer{key: key, tokenLifetime: tokenLifetime, tokens: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The App endpoints are authenticated with the JWTs.
+		err := s.verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if err != nil {
+			t.Errorf("invalid JWT for %s: %v", r.URL.Path, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p := strings.TrimPrefix(r.URL.Path, "/api/v3")
+		var resp interface{}
+		switch {
+		case r.Method == http.MethodGet && strings.HasPrefix(p, "/repos/") && strings.HasSuffix(p, "/installation"):
+			ownerRepo := strings.Split(strings.TrimPrefix(p, "/repos/"), "/")
+			var id int64
+			fmt.Sscanf(ownerRepo[0], "owner-%d", &id)
+			s.mu.Lock()
+			s.lookups = append(s.lookups, ownerRepo[0])
+			s.mu.Unlock()
+			resp = map[string]interface{}{"id": id}
+		case r.Method == http.MethodPost && strings.HasPrefix(p, "/app/installations/"):
+			id := strings.TrimSuffix(strings.TrimPrefix(p, "/app/installations/"), "/access_tokens")
+			s.mu.Lock()
+			s.tokens[id]++
+			n := s.tokens[id]
+			s.mu.Unlock()
+			resp = map[string]interface{}{
+				"token":      fmt.Sprintf("token-%s-%d", id, n),
+				"expires_at": time.Now().Add(s.tokenLifetime).UTC().Format(time.RFC3339),
+			}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *githubAppTestServer) verifyJWT(jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT: %q", jwt)
+	}
+	var header map[string]string
+	err := decodeJWTPart(parts[0], &header)
+	if err != nil {
+		return err
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		return fmt.Errorf("unexpected header: %v", header)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, digest[:], sig)
+	if err != nil {
+		return err
+	}
+
+	var claims struct {
+		IAT int64 `json:"iat"`
+		EXP int64 `json:"exp"`
+		ISS int64 `json:"iss"`
+	}
+	err = decodeJWTPart(parts[1], &claims)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	// GitHub rejects the JWTs issued in the future, or expiring more than 10 minutes later.
+	if claims.ISS != 42 || claims.IAT > now || claims.EXP <= now || claims.EXP > now+10*60 {
+		return fmt.Errorf("unexpected claims: %+v at %d", claims, now)
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *githubAppTestServer) readLookups() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lookups...)
+}
+
+func (s *githubAppTestServer) readTokens(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[id]
+}
+
+func newGitHubAppTestCredential(t *testing.T, tokenLifetime time.Duration, installationID int64) (*githubAppCredential, *githubAppTestServer) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newGitHubAppTestServer(t, key, tokenLifetime)
+	clients, err := newGitHubClientFactory(s.Client(), s.URL+"/api/v3/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newGitHubAppCredential(clients, 42, installationID, key), s
+}
+
+func githubTestToken(t *testing.T, c githubCredential, owner string) string {
+	t.Helper()
+	ts, err := c.tokenSource(context.Background(), &option{owner: owner, repo: "repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.AccessToken
+}
+
+func TestGitHubAppJWT(t *testing.T) {
+	c, s := newGitHubAppTestCredential(t, time.Hour, 0)
+	token, err := c.appTokens.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.verifyJWT(token.AccessToken)
+	if err != nil {
+		t.Error(err)
+	}
+	// The JWT is reused until shortly before the expiry.
+	if d := time.Until(token.Expiry); d < 6*time.Minute || d > githubAppJWTLifetime {
+		t.Errorf("unexpected expiry: %v", token.Expiry)
+	}
+	again, err := c.appTokens.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.AccessToken != token.AccessToken {
+		t.Error("expected the JWT to be reused")
+	}
+}
+
+func TestGitHubAppInstallations(t *testing.T) {
+	c, s := newGitHubAppTestCredential(t, time.Hour, 0)
+
+	testCases := []struct {
+		owner string
+		token string
+	}{
+		{owner: "owner-1", token: "token-1-1"},
+		{owner: "owner-2", token: "token-2-1"},
+		// The installations are cached for each owner, and so are the tokens for each installation.
+		{owner: "owner-1", token: "token-1-1"},
+		{owner: "owner-02", token: "token-2-1"},
+	}
+	for _, tc := range testCases {
+		token := githubTestToken(t, c, tc.owner)
+		if token != tc.token {
+			t.Errorf("expected %s for %s, got %s", tc.token, tc.owner, token)
+		}
+	}
+	expected := []string{"owner-1", "owner-2", "owner-02"}
+	if lookups := s.readLookups(); strings.Join(lookups, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the lookups of %v, got %v", expected, lookups)
+	}
+
+	// The installation in the configuration is used for all owners without the lookups.
+	fixed, s := newGitHubAppTestCredential(t, time.Hour, 3)
+	for _, owner := range []string{"owner-1", "owner-2"} {
+		token := githubTestToken(t, fixed, owner)
+		if token != "token-3-1" {
+			t.Errorf("expected token-3-1 for %s, got %s", owner, token)
+		}
+	}
+	if lookups := s.readLookups(); len(lookups) != 0 {
+		t.Errorf("expected no lookups, got %v", lookups)
+	}
+}
+
+func TestGitHubAppTokenRefreshMargin(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lifetime time.Duration
+		tokens   int
+	}{
+		{name: "valid", lifetime: time.Hour, tokens: 1},
+		// The tokens expiring within the margin are refreshed.
+		{name: "expiring", lifetime: githubAppTokenRefreshMargin - time.Minute, tokens: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, s := newGitHubAppTestCredential(t, tc.lifetime, 1)
+			for i := 0; i < 3; i++ {
+				githubTestToken(t, c, "owner-1")
+			}
+			if n := s.readTokens("1"); n != tc.tokens {
+				t.Errorf("expected %d tokens to be issued, got %d", tc.tokens, n)
+			}
+		})
+	}
+}
+
+func TestNewGitHubAppCredentialFromFiles(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		err := ioutil.WriteFile(p, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	appID := write("app-id", "42\n")
+	installationID := write("installation-id", " 7 ")
+	pkcs1Key := write("pkcs1.pem", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})))
+	pkcs8Key := write("pkcs8.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})))
+
+	for _, keyFile := range []string{pkcs1Key, pkcs8Key} {
+		c, err := newGitHubAppCredentialFromFiles(nil, appID, installationID, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.appID != 42 || c.installationID != 7 {
+			t.Errorf("unexpected IDs: %d %d", c.appID, c.installationID)
+		}
+	}
+	_, err = newGitHubAppCredentialFromFiles(nil, write("invalid-id", "app"), "", pkcs1Key)
+	if err == nil || !strings.Contains(err.Error(), "invalid id") {
+		t.Errorf("expected the invalid ID to be rejected, got %v", err)
+	}
+	_, err = newGitHubAppCredentialFromFiles(nil, appID, "", write("invalid.pem", "key"))
+	if err == nil || !strings.Contains(err.Error(), "no PEM data") {
+		t.Errorf("expected the invalid key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package injector
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// CredentialMapKey is the key of the ConfigMap which holds the credential mapping.
+const CredentialMapKey = "credentials.yaml"
+
+// credentialMapping is the content of the credential mapping ConfigMap.
+//
+//	credentials:
+//	- namespaces: ["team-a"]
+//	  repositories: ["team-a-org/*"]
+//	  secret:
+//	    namespace: secret-injector
+//	    name: team-a-github-token
+//	    key: token
+type credentialMapping struct {
+	Credentials []credentialRule `json:"credentials"`
+}
+
+// credentialRule maps the requests to the token stored in the Secret.
+// Empty Namespaces or Repositories match everything.
+type credentialRule struct {
+	// Namespaces are the glob patterns of the requesting namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Repositories are the glob patterns of the repositories in the form of "owner/repo".
+	Repositories []string         `json:"repositories,omitempty"`
+	Secret       credentialSecret `json:"secret"`
+}
+
+type credentialSecret struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+}
+
+func (r *credentialRule) match(opt *option) bool {
+	return matchAny(r.Namespaces, opt.namespace) && matchAny(r.Repositories, opt.owner+"/"+opt.repo)
+}
+
+func matchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mappedGitHubCredential chooses the token by the requesting namespace and the repository.
+// The mapping is read from the ConfigMap on every request, so that the changes are applied immediately.
+type mappedGitHubCredential struct {
+	client    client.Reader
+	configMap types.NamespacedName
+}
+
+func newMappedGitHubCredential(c client.Reader, configMap types.NamespacedName) *mappedGitHubCredential {
+	return &mappedGitHubCredential{
+		client:    c,
+		configMap: configMap,
+	}
+}
+
+func (c *mappedGitHubCredential) tokenSource(ctx context.Context, opt *option) (oauth2.TokenSource, error) {
+	cm := &corev1.ConfigMap{}
+	err := c.client.Get(ctx, c.configMap, cm)
+	if err != nil {
+		return nil, err
+	}
+	mapping := credentialMapping{}
+	err = yaml.UnmarshalStrict([]byte(cm.Data[CredentialMapKey]), &mapping)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential mapping in %s: %v", c.configMap, err)
+	}
+
+	for _, rule := range mapping.Credentials {
+		if !rule.match(opt) {
+			continue
+		}
+		key := rule.Secret.Key
+		if key == "" {
+			key = "token"
+		}
+		name := types.NamespacedName{Namespace: rule.Secret.Namespace, Name: rule.Secret.Name}
+		if name.Namespace == "" {
+			name.Namespace = c.configMap.Namespace
+		}
+		return newSecretGitHubCredential(c.client, name, key).tokenSource(ctx, opt)
+	}
+	return nil, &deniedError{
+		reason: fmt.Sprintf("no credential is allowed for %s/%s in namespace %s", opt.owner, opt.repo, opt.namespace),
+	}
+}
@@ -0,0 +1,87 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMappedGitHubCredential(t *testing.T) {
+	const mapping = `
+credentials:
+- namespaces: ["team-a"]
+  repositories: ["team-a-org/*"]
+  secret:
+    name: team-a-github-token
+- namespaces: ["team-b"]
+  secret:
+    namespace: other
+    name: team-b-github-token
+    key: pat
+`
+	newCredential := func(mapping string) *mappedGitHubCredential {
+		c := fake.NewFakeClient(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "secret-injector", Name: "credentials"},
+				Data:       map[string]string{CredentialMapKey: mapping},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "secret-injector", Name: "team-a-github-token"},
+				Data:       map[string][]byte{"token": []byte("token-a\n")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "team-b-github-token"},
+				Data:       map[string][]byte{"pat": []byte("token-b")},
+			},
+		)
+		return newMappedGitHubCredential(c, types.NamespacedName{Namespace: "secret-injector", Name: "credentials"})
+	}
+
+	testCases := []struct {
+		name      string
+		namespace string
+		owner     string
+		token     string
+		denied    bool
+	}{
+		{name: "default namespace and key", namespace: "team-a", owner: "team-a-org", token: "token-a"},
+		{name: "any repository", namespace: "team-b", owner: "anyone", token: "token-b"},
+		{name: "other repository", namespace: "team-a", owner: "team-b-org", denied: true},
+		{name: "other namespace", namespace: "team-c", owner: "team-a-org", denied: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, err := newCredential(mapping).tokenSource(context.Background(), &option{namespace: tc.namespace, owner: tc.owner, repo: "repo"})
+			if tc.denied {
+				var denied *deniedError
+				if !errors.As(err, &denied) {
+					t.Errorf("expected deniedError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := ts.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != tc.token {
+				t.Errorf("expected %s, got %s", tc.token, token.AccessToken)
+			}
+		})
+	}
+
+	// The unknown fields are rejected not to ignore the misspelled restrictions.
+	_, err := newCredential("credentials:\n- namespace: [team-a]\n  secret:\n    name: team-a-github-token\n").
+		tokenSource(context.Background(), &option{namespace: "team-a", owner: "team-a-org", repo: "repo"})
+	if err == nil || !strings.Contains(err.Error(), "invalid credential mapping") {
+		t.Errorf("expected the unknown field to be rejected, got %v", err)
+	}
+}
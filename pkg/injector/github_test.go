@@ -0,0 +1,269 @@
+package injector
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const githubTestCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// githubTestServer serves the repository "owner/repo" in the same way as GitHub REST API v3.
+// The files are keyed by the paths, and their SHAs are "blob-" followed by the paths.
+// The SHAs of the directories are "tree-" followed by the paths, and that of the root is githubTestCommit.
+type githubTestServer struct {
+	*httptest.Server
+	files map[string]string
+
+	mu    sync.Mutex
+	blobs []string
+	trees []string
+}
+
+func newGitHubTestServer(t *testing.T, files map[string]string) *githubTestServer {
+	s := &githubTestServer{files: files}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "/api/v3/repos/owner/repo"
+		p := r.URL.Path
+		if !strings.HasPrefix(p, prefix) {
+			t.Errorf("unexpected request: %s", p)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		p = strings.TrimPrefix(p, prefix)
+
+		var resp interface{}
+		switch {
+		case strings.HasPrefix(p, "/contents/"):
+			if r.URL.Query().Get("ref") != githubTestCommit {
+				t.Errorf("unexpected ref: %s", r.URL.RawQuery)
+			}
+			resp = s.contents(strings.TrimPrefix(p, "/contents/"))
+		case strings.HasPrefix(p, "/git/blobs/"):
+			name := strings.TrimPrefix(p, "/git/blobs/blob-")
+			s.mu.Lock()
+			s.blobs = append(s.blobs, name)
+			s.mu.Unlock()
+			w.Write([]byte(s.files[name]))
+			return
+		case strings.HasPrefix(p, "/git/trees/"):
+			sha := strings.TrimPrefix(p, "/git/trees/")
+			recursive := r.URL.Query().Get("recursive") != ""
+			s.mu.Lock()
+			s.trees = append(s.trees, fmt.Sprintf("%s recursive=%t", sha, recursive))
+			s.mu.Unlock()
+			resp = s.tree(sha, recursive)
+		}
+		if resp == nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// contents returns the response of the contents API. The contents of the files larger than 1 MB are omitted.
+func (s *githubTestServer) contents(p string) interface{} {
+	file := func(name string) map[string]interface{} {
+		m := map[string]interface{}{
+			"type": "file", "name": path.Base(name), "path": name, "sha": "blob-" + name, "size": len(s.files[name]),
+		}
+		if len(s.files[name]) > 1024*1024 {
+			m["encoding"] = "none"
+			m["content"] = ""
+		} else {
+			m["encoding"] = "base64"
+			m["content"] = base64.StdEncoding.EncodeToString([]byte(s.files[name]))
+		}
+		return m
+	}
+	if _, ok := s.files[p]; ok {
+		return file(p)
+	}
+	var dir []interface{}
+	for name := range s.files {
+		if strings.HasPrefix(name, p+"/") && !strings.Contains(strings.TrimPrefix(name, p+"/"), "/") {
+			dir = append(dir, file(name))
+		}
+	}
+	if dir == nil {
+		return nil
+	}
+	return dir
+}
+
+// tree returns the response of the trees API. The paths are relative to the tree.
+func (s *githubTestServer) tree(sha string, recursive bool) interface{} {
+	var dir string
+	switch {
+	case sha == githubTestCommit:
+	case strings.HasPrefix(sha, "tree-"):
+		dir = strings.TrimPrefix(sha, "tree-") + "/"
+	default:
+		return nil
+	}
+
+	var entries []map[string]interface{}
+	seen := map[string]bool{}
+	for name, content := range s.files {
+		if !strings.HasPrefix(name, dir) {
+			continue
+		}
+		rel := strings.TrimPrefix(name, dir)
+		parts := strings.Split(rel, "/")
+		// The subdirectories are listed before the files in them.
+		for i := 1; i < len(parts); i++ {
+			sub := strings.Join(parts[:i], "/")
+			if !seen[sub] && (recursive || i == 1) {
+				seen[sub] = true
+				entries = append(entries, map[string]interface{}{
+					"path": sub, "mode": "040000", "type": "tree", "sha": "tree-" + dir + sub,
+				})
+			}
+		}
+		if recursive || len(parts) == 1 {
+			entries = append(entries, map[string]interface{}{
+				"path": rel, "mode": "100644", "type": "blob", "sha": "blob-" + name, "size": len(content),
+			})
+		}
+	}
+	if entries == nil {
+		return nil
+	}
+	return map[string]interface{}{"sha": sha, "tree": entries}
+}
+
+func (s *githubTestServer) readBlobs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blobs
+}
+
+func (s *githubTestServer) readTrees() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trees
+}
+
+func newGitHubTestRepository(t *testing.T, s *githubTestServer, maxSize int) *githubRepository {
+	clients, err := newGitHubClientFactory(s.Client(), s.URL+"/api/v3/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newGitHubRepository(clients, newStaticGitHubCredential(""), maxSize)
+}
+
+func TestGitHubMaxSize(t *testing.T) {
+	large := strings.Repeat("x", 2*1024*1024)
+	files := map[string]string{
+		"small.txt":     "small",
+		"large.txt":     large,
+		"dir/small.txt": "small",
+		"dir/large.txt": large,
+		"ok/a.txt":      "a",
+		"ok/sub/b.txt":  "b",
+	}
+
+	testCases := []struct {
+		name      string
+		path      string
+		recursive bool
+		err       bool
+		blobs     []string
+	}{
+		{name: "small file", path: "small.txt"},
+		{name: "large file", path: "large.txt", err: true},
+		{name: "directory with a large file", path: "dir", err: true},
+		{name: "tree with a large file", path: "dir", recursive: true, err: true},
+		{name: "directory", path: "ok", blobs: []string{"ok/a.txt"}},
+		{name: "tree", path: "ok", recursive: true, blobs: []string{"ok/a.txt", "ok/sub/b.txt"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newGitHubTestServer(t, files)
+			r := newGitHubTestRepository(t, s, 1024*1024)
+			opt := &option{provider: providerGitHub, owner: "owner", repo: "repo", repository: "owner/repo", recursive: tc.recursive}
+			_, _, err := r.getContents(context.Background(), opt, githubTestCommit, tc.path)
+			if tc.err {
+				if err == nil || !strings.Contains(err.Error(), "exceeds the maximum size") {
+					t.Errorf("expected the large file to be rejected, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			// The large files are never downloaded.
+			blobs := s.readBlobs()
+			sort.Strings(blobs)
+			if !reflect.DeepEqual(blobs, tc.blobs) {
+				t.Errorf("expected the blobs %v to be read, got %v", tc.blobs, blobs)
+			}
+		})
+	}
+}
+
+func TestGitHubListTree(t *testing.T) {
+	files := map[string]string{
+		"top.txt":          "top",
+		"a/a.txt":          "a",
+		"a/b/b.txt":        "b",
+		"a/b/c/c.txt":      "c",
+		"a/bb/other.txt":   "other",
+		"other/b/file.txt": "other",
+	}
+	s := newGitHubTestServer(t, files)
+	r := newGitHubTestRepository(t, s, 1024*1024)
+	client, err := r.client(context.Background(), &option{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &option{provider: providerGitHub, owner: "owner", repo: "repo", repository: "owner/repo"}
+
+	entries, err := r.listTree(context.Background(), client, opt, githubTestCommit, "/a/b/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.sha != "blob-"+entry.path || entry.size != len(files[entry.path]) {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+		paths = append(paths, entry.path)
+	}
+	sort.Strings(paths)
+	expected := []string{"a/b/b.txt", "a/b/c/c.txt"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	// Only the subtree is read recursively.
+	trees := []string{
+		githubTestCommit + " recursive=false",
+		"tree-a recursive=false",
+		"tree-a/b recursive=true",
+	}
+	if !reflect.DeepEqual(s.readTrees(), trees) {
+		t.Errorf("expected the trees %v to be read, got %v", trees, s.readTrees())
+	}
+
+	_, err = r.listTree(context.Background(), client, opt, githubTestCommit, "a/missing")
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a/missing not to be found, got %v", err)
+	}
+	_, err = r.listTree(context.Background(), client, opt, githubTestCommit, "top.txt")
+	if err == nil {
+		t.Error("listed a file as a directory")
+	}
+}
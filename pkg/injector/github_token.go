@@ -0,0 +1,118 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tokenFileCheckInterval is the interval to check whether the token file is updated.
+const tokenFileCheckInterval = 10 * time.Second
+
+// fileGitHubCredential reads the token from a file, and reloads it when the file is changed.
+type fileGitHubCredential struct {
+	filename string
+
+	mu        sync.Mutex
+	ts        oauth2.TokenSource
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newFileGitHubCredential(filename string) (*fileGitHubCredential, error) {
+	c := &fileGitHubCredential{filename: filename}
+	err := c.reload(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *fileGitHubCredential) tokenSource(ctx context.Context, opt *option) (oauth2.TokenSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.checkedAt) >= tokenFileCheckInterval {
+		// Keep using the current token if the file is being replaced.
+		err := c.reload(now)
+		if err != nil && c.ts == nil {
+			return nil, err
+		}
+	}
+	return c.ts, nil
+}
+
+// reload reads the token file if it is modified. c.mu should be held by the caller except in the constructor.
+func (c *fileGitHubCredential) reload(now time.Time) error {
+	c.checkedAt = now
+
+	// Kubernetes updates the mounted Secret by swapping a symlink, so use Stat rather than Lstat.
+	fi, err := os.Stat(c.filename)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(c.modTime) && c.ts != nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(c.filename)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return errors.New("empty token in " + c.filename)
+	}
+	c.ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	c.modTime = fi.ModTime()
+	return nil
+}
+
+// secretGitHubCredential reads the token from a Kubernetes Secret on every request.
+// The client is expected to be backed by the manager's cache, so that the update is visible immediately.
+type secretGitHubCredential struct {
+	client client.Reader
+	name   types.NamespacedName
+	key    string
+}
+
+func newSecretGitHubCredential(c client.Reader, name types.NamespacedName, key string) *secretGitHubCredential {
+	return &secretGitHubCredential{
+		client: c,
+		name:   name,
+		key:    key,
+	}
+}
+
+func (c *secretGitHubCredential) tokenSource(ctx context.Context, opt *option) (oauth2.TokenSource, error) {
+	sec := &corev1.Secret{}
+	err := c.client.Get(ctx, c.name, sec)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(sec.Data[c.key]))
+	if token == "" {
+		return nil, fmt.Errorf("no token in the secret %s (key: %s)", c.name, c.key)
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+}
+
+// parseNamespacedName parses a string in the form of "namespace/name".
+func parseNamespacedName(s string) (types.NamespacedName, error) {
+	nsName := strings.Split(s, "/")
+	if len(nsName) != 2 || nsName[0] == "" || nsName[1] == "" {
+		return types.NamespacedName{}, errors.New("invalid namespaced name: " + s)
+	}
+	return types.NamespacedName{Namespace: nsName[0], Name: nsName[1]}, nil
+}
@@ -0,0 +1,167 @@
+package injector
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// githubAuthTestServer records the Authorization headers of the requests to GitHub.
+type githubAuthTestServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	tokens []string
+}
+
+func newGitHubAuthTestServer(t *testing.T) *githubAuthTestServer {
+	s := &githubAuthTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.tokens = append(s.tokens, r.Header.Get("Authorization"))
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"login": "user"})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// lastToken requests GitHub with the credential, and returns the Authorization header sent.
+func (s *githubAuthTestServer) lastToken(t *testing.T, c githubCredential) string {
+	t.Helper()
+	clients, err := newGitHubClientFactory(s.Client(), s.URL+"/api/v3/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newGitHubRepository(clients, c, maxSecretSize)
+	client, err := r.client(context.Background(), &option{owner: "owner", repo: "repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = client.Users.Get(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[len(s.tokens)-1]
+}
+
+// writeTokenFile writes the token in the same way as Kubernetes updates the mounted Secrets,
+// i.e. writes the new file in a new directory and swaps the symlink "..data" to the directory.
+func writeTokenFile(t *testing.T, dir, version, token string, modTime time.Time) {
+	t.Helper()
+	versionDir := filepath.Join(dir, version)
+	err := os.Mkdir(versionDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(versionDir, "token")
+	err = ioutil.WriteFile(p, []byte(token), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(p, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(version, filepath.Join(dir, "..data_tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileGitHubCredential(t *testing.T) {
+	s := newGitHubAuthTestServer(t)
+	dir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour)
+	writeTokenFile(t, dir, "..v1", "token-1\n", modTime)
+	err := os.Symlink(filepath.Join("..data", "token"), filepath.Join(dir, "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newFileGitHubCredential(filepath.Join(dir, "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := s.lastToken(t, c); token != "Bearer token-1" {
+		t.Errorf("expected token-1, got %s", token)
+	}
+
+	// The file is checked at most once in tokenFileCheckInterval.
+	writeTokenFile(t, dir, "..v2", "token-2", modTime.Add(time.Minute))
+	if token := s.lastToken(t, c); token != "Bearer token-1" {
+		t.Errorf("expected token-1 until the next check, got %s", token)
+	}
+	c.checkedAt = c.checkedAt.Add(-tokenFileCheckInterval)
+	if token := s.lastToken(t, c); token != "Bearer token-2" {
+		t.Errorf("expected token-2 after the interval, got %s", token)
+	}
+
+	// The current token is kept while the file is missing or empty.
+	err = os.Remove(filepath.Join(dir, "..data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.checkedAt = c.checkedAt.Add(-tokenFileCheckInterval)
+	if token := s.lastToken(t, c); token != "Bearer token-2" {
+		t.Errorf("expected token-2 while the file is missing, got %s", token)
+	}
+	writeTokenFile(t, dir, "..v3", "\n", modTime.Add(2*time.Minute))
+	c.checkedAt = c.checkedAt.Add(-tokenFileCheckInterval)
+	if token := s.lastToken(t, c); token != "Bearer token-2" {
+		t.Errorf("expected token-2 while the file is empty, got %s", token)
+	}
+
+	_, err = newFileGitHubCredential(filepath.Join(dir, "token"))
+	if err == nil || !strings.Contains(err.Error(), "empty token") {
+		t.Errorf("expected the empty token to be rejected, got %v", err)
+	}
+}
+
+func TestSecretGitHubCredential(t *testing.T) {
+	s := newGitHubAuthTestServer(t)
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "secret-injector", Name: "github-token"},
+		Data:       map[string][]byte{"token": []byte("token-1\n")},
+	}
+	c := fake.NewFakeClient(sec)
+	credential := newSecretGitHubCredential(c, types.NamespacedName{Namespace: "secret-injector", Name: "github-token"}, "token")
+	if token := s.lastToken(t, credential); token != "Bearer token-1" {
+		t.Errorf("expected token-1, got %s", token)
+	}
+
+	// The Secret is read on every request.
+	sec.Data["token"] = []byte("token-2")
+	err := c.Update(context.Background(), sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := s.lastToken(t, credential); token != "Bearer token-2" {
+		t.Errorf("expected token-2, got %s", token)
+	}
+
+	other := newSecretGitHubCredential(c, types.NamespacedName{Namespace: "secret-injector", Name: "github-token"}, "pat")
+	_, err = other.tokenSource(context.Background(), &option{})
+	if err == nil || !strings.Contains(err.Error(), "no token") {
+		t.Errorf("expected the missing key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package injector
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultGitLabURL = "https://gitlab.com/"
+
+type gitlabRepository struct {
+	client  *http.Client
+	baseURL *url.URL
+	token   string
+}
+
+type gitlabFile struct {
+	FileName string `json:"file_name"`
+	FilePath string `json:"file_path"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+	BlobID   string `json:"blob_id"`
+}
+
+type gitlabTreeNode struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+type gitlabCommit struct {
+	ID string `json:"id"`
+}
+
+// gitlabRef is a branch or a tag.
+type gitlabRef struct {
+	Name   string       `json:"name"`
+	Commit gitlabCommit `json:"commit"`
+}
+
+type gitlabProject struct {
+	DefaultBranch string `json:"default_branch"`
+}
+
+// gitlabError is the error returned by GitLab REST API.
+type gitlabError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *gitlabError) Error() string {
+	return fmt.Sprintf("gitlab: %d %s", e.StatusCode, e.Message)
+}
+
+func newGitLabRepository(client *http.Client, baseURL, token string) (*gitlabRepository, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if baseURL == "" {
+		baseURL = defaultGitLabURL
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitlabRepository{
+		client:  client,
+		baseURL: u.ResolveReference(&url.URL{Path: "api/v4/"}),
+		token:   token,
+	}, nil
+}
+
+func (r *gitlabRepository) resolve(ctx context.Context, opt *option) (*revision, error) {
+	if opt.commit != "" {
+		var commit gitlabCommit
+		_, err := r.get(ctx, r.projectPath(opt)+"/repository/commits/"+url.PathEscape(opt.commit), nil, &commit)
+		if err != nil {
+			return nil, err
+		}
+		return &revision{commit: commit.ID}, nil
+	}
+
+	if opt.tag != "" {
+		var tag gitlabRef
+		_, err := r.get(ctx, r.projectPath(opt)+"/repository/tags/"+url.PathEscape(opt.tag), nil, &tag)
+		if err != nil {
+			return nil, err
+		}
+		return &revision{ref: opt.ref(), commit: tag.Commit.ID}, nil
+	}
+
+	branch := strings.TrimPrefix(opt.branch, "refs/heads/")
+	if branch == "" {
+		var project gitlabProject
+		_, err := r.get(ctx, r.projectPath(opt), nil, &project)
+		if err != nil {
+			return nil, err
+		}
+		branch = project.DefaultBranch
+	}
+	var ref gitlabRef
+	_, err := r.get(ctx, r.projectPath(opt)+"/repository/branches/"+url.PathEscape(branch), nil, &ref)
+	if err != nil {
+		return nil, err
+	}
+	return &revision{ref: "refs/heads/" + branch, commit: ref.Commit.ID}, nil
+}
+
+func (r *gitlabRepository) getContents(ctx context.Context, opt *option, commit, path string) (*blob, []*blob, error) {
+	path = strings.Trim(path, "/")
+	file, err := r.getFile(ctx, opt, path, commit)
+	if err == nil {
+		return file, nil, nil
+	}
+	if e, ok := err.(*gitlabError); !ok || e.StatusCode != http.StatusNotFound {
+		return nil, nil, err
+	}
+
+	var files []*blob
+	query := url.Values{}
+	query.Set("path", path)
+	query.Set("ref", commit)
+	query.Set("per_page", "100")
+	if opt.recursive {
+		query.Set("recursive", "true")
+	}
+	for page := "1"; page != ""; {
+		query.Set("page", page)
+		var nodes []gitlabTreeNode
+		header, err := r.get(ctx, r.projectPath(opt)+"/repository/tree", query, &nodes)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, node := range nodes {
+			if node.Type != "blob" {
+				continue
+			}
+			file, err := r.getFile(ctx, opt, node.Path, commit)
+			if err != nil {
+				return nil, nil, err
+			}
+			files = append(files, file)
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return nil, files, nil
+}
+
+func (r *gitlabRepository) getFile(ctx context.Context, opt *option, path, ref string) (*blob, error) {
+	query := url.Values{}
+	query.Set("ref", ref)
+	var file gitlabFile
+	_, err := r.get(ctx, r.projectPath(opt)+"/repository/files/"+url.PathEscape(path), query, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte(file.Content)
+	if file.Encoding == "base64" {
+		data, err = base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &blob{
+		name: file.FileName,
+		path: file.FilePath,
+		sha:  file.BlobID,
+		data: data,
+	}, nil
+}
+
+func (r *gitlabRepository) lfsEndpoint(ctx context.Context, opt *option) (*lfsEndpoint, error) {
+	// The API is served under /api/v4/ of the web server.
+	web := r.baseURL.ResolveReference(&url.URL{Path: "../../"})
+	return &lfsEndpoint{
+		url:      web.String() + opt.owner + "/" + opt.repo + ".git/info/lfs",
+		client:   r.client,
+		username: "oauth2",
+		password: r.token,
+	}, nil
+}
+
+// projectPath returns the API path of the project, which is identified by its URL-encoded full path.
+func (r *gitlabRepository) projectPath(opt *option) string {
+	return "projects/" + url.PathEscape(opt.owner+"/"+opt.repo)
+}
+
+func (r *gitlabRepository) get(ctx context.Context, path string, query url.Values, v interface{}) (http.Header, error) {
+	u := r.baseURL.String() + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if r.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		msg := body.Error
+		if body.Message != nil {
+			msg = fmt.Sprint(body.Message)
+		}
+		if msg == "" {
+			msg = http.StatusText(resp.StatusCode)
+		}
+		return nil, &gitlabError{StatusCode: resp.StatusCode, Message: msg}
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return nil, fmt.Errorf("gitlab: could not decode response of %s: %v", path, err)
+	}
+	return resp.Header, nil
+}
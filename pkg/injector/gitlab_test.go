@@ -0,0 +1,197 @@
+package injector
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	gitlabTestCommit = "0123456789abcdef0123456789abcdef01234567"
+	gitlabTestTag    = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+// newGitLabTestServer serves the project "group/sub/project" in the same way as GitLab REST API v4.
+// The tree of "dir" is split into two pages.
+func newGitLabTestServer(t *testing.T) *httptest.Server {
+	files := map[string]string{
+		"config.yaml": "foo: bar\n",
+		"dir/a.txt":   "a",
+		"dir/b.txt":   "b",
+	}
+	file := func(p string) interface{} {
+		return gitlabFile{
+			FileName: p[strings.LastIndex(p, "/")+1:],
+			FilePath: p,
+			Encoding: "base64",
+			Content:  base64.StdEncoding.EncodeToString([]byte(files[p])),
+			BlobID:   "blob-" + p,
+		}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"401 Unauthorized"}`))
+			return
+		}
+		const prefix = "/api/v4/projects/group%2Fsub%2Fproject"
+		p := r.URL.EscapedPath()
+		if !strings.HasPrefix(p, prefix) {
+			t.Errorf("unexpected request: %s", p)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		p = strings.TrimPrefix(p, prefix)
+		query := r.URL.Query()
+
+		var resp interface{}
+		switch {
+		case p == "":
+			resp = gitlabProject{DefaultBranch: "main"}
+		case p == "/repository/branches/main" || p == "/repository/branches/dev":
+			resp = gitlabRef{Name: strings.TrimPrefix(p, "/repository/branches/"), Commit: gitlabCommit{ID: gitlabTestCommit}}
+		case p == "/repository/tags/v1":
+			resp = gitlabRef{Name: "v1", Commit: gitlabCommit{ID: gitlabTestTag}}
+		case p == "/repository/commits/"+gitlabTestCommit:
+			resp = gitlabCommit{ID: gitlabTestCommit}
+		case strings.HasPrefix(p, "/repository/files/"):
+			name := strings.Replace(strings.TrimPrefix(p, "/repository/files/"), "%2F", "/", -1)
+			if _, ok := files[name]; !ok || query.Get("ref") != gitlabTestCommit {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message":"404 File Not Found"}`))
+				return
+			}
+			resp = file(name)
+		case p == "/repository/tree":
+			if query.Get("path") != "dir" || query.Get("ref") != gitlabTestCommit {
+				t.Errorf("unexpected query of the tree: %s", r.URL.RawQuery)
+			}
+			switch query.Get("page") {
+			case "1":
+				w.Header().Set("X-Next-Page", "2")
+				resp = []gitlabTreeNode{
+					{ID: "blob-dir/a.txt", Name: "a.txt", Type: "blob", Path: "dir/a.txt"},
+					{ID: "tree-dir/sub", Name: "sub", Type: "tree", Path: "dir/sub"},
+				}
+			case "2":
+				w.Header().Set("X-Next-Page", "")
+				resp = []gitlabTreeNode{
+					{ID: "blob-dir/b.txt", Name: "b.txt", Type: "blob", Path: "dir/b.txt"},
+				}
+			default:
+				t.Errorf("unexpected page: %s", query.Get("page"))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"404 Not Found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestGitLabResolve(t *testing.T) {
+	server := newGitLabTestServer(t)
+	defer server.Close()
+	r, err := newGitLabRepository(server.Client(), server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		opt      *option
+		expected *revision
+	}{
+		{
+			name:     "default branch",
+			opt:      &option{},
+			expected: &revision{ref: "refs/heads/main", commit: gitlabTestCommit},
+		},
+		{
+			name:     "branch",
+			opt:      &option{branch: "dev"},
+			expected: &revision{ref: "refs/heads/dev", commit: gitlabTestCommit},
+		},
+		{
+			name:     "tag",
+			opt:      &option{tag: "v1"},
+			expected: &revision{ref: "refs/tags/v1", commit: gitlabTestTag},
+		},
+		{
+			name:     "commit",
+			opt:      &option{commit: gitlabTestCommit},
+			expected: &revision{commit: gitlabTestCommit},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opt.owner, tc.opt.repo = "group/sub", "project"
+			rev, err := r.resolve(context.Background(), tc.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rev, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, rev)
+			}
+		})
+	}
+
+	_, err = r.resolve(context.Background(), &option{owner: "group/sub", repo: "project", tag: "missing"})
+	if e, ok := err.(*gitlabError); !ok || e.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", err)
+	}
+}
+
+func TestGitLabGetContents(t *testing.T) {
+	server := newGitLabTestServer(t)
+	defer server.Close()
+	r, err := newGitLabRepository(server.Client(), server.URL+"/", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &option{owner: "group/sub", repo: "project"}
+
+	file, dir, err := r.getContents(context.Background(), opt, gitlabTestCommit, "config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != nil {
+		t.Errorf("expected a file, got a directory")
+	}
+	expected := &blob{name: "config.yaml", path: "config.yaml", sha: "blob-config.yaml", data: []byte("foo: bar\n")}
+	if !reflect.DeepEqual(file, expected) {
+		t.Errorf("expected %+v, got %+v", expected, file)
+	}
+
+	// The file API returns 404 for the directory, and the tree is read instead.
+	file, dir, err = r.getContents(context.Background(), opt, gitlabTestCommit, "/dir/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != nil {
+		t.Errorf("expected a directory, got a file")
+	}
+	expectedDir := []*blob{
+		{name: "a.txt", path: "dir/a.txt", sha: "blob-dir/a.txt", data: []byte("a")},
+		{name: "b.txt", path: "dir/b.txt", sha: "blob-dir/b.txt", data: []byte("b")},
+	}
+	if !reflect.DeepEqual(dir, expectedDir) {
+		t.Errorf("expected %+v, got %+v", expectedDir, dir)
+	}
+
+	bad, err := newGitLabRepository(server.Client(), server.URL, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = bad.getContents(context.Background(), opt, gitlabTestCommit, "config.yaml")
+	if e, ok := err.(*gitlabError); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package injector
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// secretKeyRegexp matches the valid keys of Secrets.
+var secretKeyRegexp = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// splitList splits the comma separated list in the annotation.
+func splitList(s string) []string {
+	var ret []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e != "" {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// parseRenames parses the comma separated "new=old" pairs in the annotation, and returns the map from the new keys to the old keys.
+func parseRenames(s string) (map[string]string, error) {
+	var ret map[string]string
+	for _, e := range splitList(s) {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("invalid rename: " + e)
+		}
+		if ret == nil {
+			ret = map[string]string{}
+		}
+		newKey, oldKey := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if _, ok := ret[newKey]; ok {
+			return nil, errors.New("duplicate rename: " + newKey)
+		}
+		ret[newKey] = oldKey
+	}
+	return ret, nil
+}
+
+// validateKeyMapping validates the globs, the prefix, the suffix and the renames of the keys in opt.
+func validateKeyMapping(opt *option) error {
+	for _, pattern := range append(append([]string{}, opt.include...), opt.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob %s: %v", pattern, err)
+		}
+	}
+	for _, affix := range []string{opt.keyPrefix, opt.keySuffix} {
+		if affix != "" && !secretKeyRegexp.MatchString(affix) {
+			return errors.New("invalid key prefix or suffix: " + affix)
+		}
+	}
+	renamed := map[string]bool{}
+	for newKey, oldKey := range opt.rename {
+		if !secretKeyRegexp.MatchString(newKey) {
+			return errors.New("invalid key: " + newKey)
+		}
+		if oldKey == "" {
+			return fmt.Errorf("empty key to be renamed to %s", newKey)
+		}
+		if renamed[oldKey] {
+			return fmt.Errorf("%s is renamed twice", oldKey)
+		}
+		renamed[oldKey] = true
+	}
+	return nil
+}
+
+// keyIncluded returns true if the key matches any of the include globs, and none of the exclude globs.
+// All keys are included when there are no include globs.
+func keyIncluded(key string, include, exclude []string) bool {
+	return matchAny(include, key) && (len(exclude) == 0 || !matchAny(exclude, key))
+}
+
+// mapKeys filters and renames the keys of src. The hashes of the directory sources are keyed by the new keys,
+// so that the hash annotations match the keys of the Secret.
+// The renamed keys are used as they are, and the prefix and the suffix are added to the other keys.
+func mapKeys(src *source, opt *option) error {
+	renamed := make(map[string]string, len(opt.rename))
+	for newKey, oldKey := range opt.rename {
+		renamed[oldKey] = newKey
+	}
+
+	data := make(map[string]string, len(src.data))
+	keys := make(map[string]string, len(src.data))
+	for k, v := range src.data {
+		if !keyIncluded(k, opt.include, opt.exclude) {
+			continue
+		}
+		name, ok := renamed[k]
+		if !ok {
+			name = opt.keyPrefix + k + opt.keySuffix
+		}
+		if _, ok := data[name]; ok {
+			return fmt.Errorf("duplicate key after renaming: %s", name)
+		}
+		data[name] = v
+		keys[k] = name
+	}
+	for newKey, oldKey := range opt.rename {
+		if _, ok := data[newKey]; !ok {
+			return fmt.Errorf("%s to be renamed to %s is not found or excluded in %s", oldKey, newKey, opt.source)
+		}
+	}
+
+	src.data = data
+	for _, part := range append([]*source{src}, src.overlays...) {
+		if part.srcType != typeDir {
+			continue
+		}
+		hash := make(map[string]string, len(part.dirHash))
+		for k, h := range part.dirHash {
+			if name, ok := keys[k]; ok {
+				hash[name] = h
+			}
+		}
+		part.dirHash = hash
+	}
+	return nil
+}
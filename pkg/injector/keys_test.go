@@ -0,0 +1,164 @@
+package injector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapKeys(t *testing.T) {
+	values := map[string]string{
+		"DB_USER":     "user",
+		"DB_PASSWORD": "pass",
+		"DB_HOST":     "host",
+		"API_KEY":     "key",
+	}
+	testCases := []struct {
+		name     string
+		opt      *option
+		expected map[string]string
+		err      string
+	}{
+		{
+			name:     "no mapping",
+			opt:      &option{},
+			expected: values,
+		},
+		{
+			name:     "include",
+			opt:      &option{include: []string{"DB_*"}},
+			expected: map[string]string{"DB_USER": "user", "DB_PASSWORD": "pass", "DB_HOST": "host"},
+		},
+		{
+			name:     "exclude",
+			opt:      &option{exclude: []string{"DB_*"}},
+			expected: map[string]string{"API_KEY": "key"},
+		},
+		// The exclude globs take precedence over the include globs.
+		{
+			name:     "include and exclude",
+			opt:      &option{include: []string{"DB_*", "API_KEY"}, exclude: []string{"*_PASSWORD", "API_*"}},
+			expected: map[string]string{"DB_USER": "user", "DB_HOST": "host"},
+		},
+		{
+			name:     "prefix and suffix",
+			opt:      &option{include: []string{"DB_USER", "API_KEY"}, keyPrefix: "app.", keySuffix: ".txt"},
+			expected: map[string]string{"app.DB_USER.txt": "user", "app.API_KEY.txt": "key"},
+		},
+		// The renamed keys are used as they are without the prefix and the suffix.
+		{
+			name:     "rename",
+			opt:      &option{include: []string{"DB_*"}, keyPrefix: "db-", rename: map[string]string{"username": "DB_USER"}},
+			expected: map[string]string{"username": "user", "db-DB_PASSWORD": "pass", "db-DB_HOST": "host"},
+		},
+		{
+			name: "rename collision",
+			opt:  &option{include: []string{"DB_*"}, keyPrefix: "db-", rename: map[string]string{"db-DB_HOST": "DB_USER"}},
+			err:  "duplicate key after renaming: db-DB_HOST",
+		},
+		{
+			name: "rename collision without the prefix",
+			opt:  &option{rename: map[string]string{"API_KEY": "DB_USER"}},
+			err:  "duplicate key after renaming: API_KEY",
+		},
+		{
+			name: "rename a missing key",
+			opt:  &option{source: "values", rename: map[string]string{"token": "TOKEN"}},
+			err:  "TOKEN to be renamed to token is not found or excluded in values",
+		},
+		{
+			name: "rename an excluded key",
+			opt:  &option{source: "values", exclude: []string{"API_*"}, rename: map[string]string{"key": "API_KEY"}},
+			err:  "API_KEY to be renamed to key is not found or excluded in values",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := make(map[string]string, len(values))
+			for k, v := range values {
+				data[k] = v
+			}
+			src := &source{srcType: typeFile, data: data}
+			err := mapKeys(src, tc.opt)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(src.data, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, src.data)
+			}
+		})
+	}
+}
+
+func TestMapKeysDirHash(t *testing.T) {
+	src := &source{
+		srcType: typeDir,
+		data:    map[string]string{"a": "1", "b": "2", "c": "3"},
+		dirHash: map[string]string{"a": "hash-a", "b": "hash-b", "c": "hash-c"},
+		overlays: []*source{
+			{srcType: typeDir, dirHash: map[string]string{"c": "hash-c2"}},
+		},
+	}
+	opt := &option{exclude: []string{"b"}, keyPrefix: "p-", rename: map[string]string{"renamed": "a"}}
+	err := mapKeys(src, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hashes are keyed by the new keys, and those of the excluded keys are dropped.
+	expected := map[string]string{"renamed": "hash-a", "p-c": "hash-c"}
+	if !reflect.DeepEqual(src.dirHash, expected) {
+		t.Errorf("expected %v, got %v", expected, src.dirHash)
+	}
+	if !reflect.DeepEqual(src.overlays[0].dirHash, map[string]string{"p-c": "hash-c2"}) {
+		t.Errorf("expected the hash of p-c, got %v", src.overlays[0].dirHash)
+	}
+}
+
+func TestValidateKeyMapping(t *testing.T) {
+	testCases := []struct {
+		name string
+		opt  *option
+		err  string
+	}{
+		{name: "valid", opt: &option{include: []string{"DB_*"}, exclude: []string{"*[0-9]"}, keyPrefix: "app.", rename: map[string]string{"user": "DB_USER"}}},
+		{name: "invalid glob", opt: &option{exclude: []string{"[a-"}}, err: "invalid glob"},
+		{name: "invalid prefix", opt: &option{keyPrefix: "app/"}, err: "invalid key prefix or suffix"},
+		{name: "invalid suffix", opt: &option{keySuffix: " "}, err: "invalid key prefix or suffix"},
+		{name: "invalid new key", opt: &option{rename: map[string]string{"a/b": "c"}}, err: "invalid key: a/b"},
+		{name: "empty old key", opt: &option{rename: map[string]string{"a": ""}}, err: "empty key to be renamed to a"},
+		{name: "renamed twice", opt: &option{rename: map[string]string{"a": "c", "b": "c"}}, err: "c is renamed twice"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateKeyMapping(tc.opt)
+			if tc.err == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected the error %q, got %v", tc.err, err)
+			}
+		})
+	}
+
+	renames, err := parseRenames(" user = DB_USER, password=DB_PASSWORD ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"user": "DB_USER", "password": "DB_PASSWORD"}
+	if !reflect.DeepEqual(renames, expected) {
+		t.Errorf("expected %v, got %v", expected, renames)
+	}
+	_, err = parseRenames("a=b,a=c")
+	if err == nil || !strings.Contains(err.Error(), "duplicate rename: a") {
+		t.Errorf("expected the duplicate rename to be rejected, got %v", err)
+	}
+}
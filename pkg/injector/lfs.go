@@ -0,0 +1,247 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// This file resolves the Git LFS pointers (https://github.com/git-lfs/git-lfs/blob/master/docs/spec.md)
+// in the sources to the objects with the batch API of the LFS servers.
+
+const (
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	lfsMediaType      = "application/vnd.git-lfs+json"
+	// lfsPointerMaxSize is the maximum size of the pointer files in the specification.
+	lfsPointerMaxSize = 1024
+)
+
+// lfsRepository is implemented by the repositories which serve the Git LFS objects.
+type lfsRepository interface {
+	// lfsEndpoint returns the LFS server of the repository specified by opt.
+	lfsEndpoint(ctx context.Context, opt *option) (*lfsEndpoint, error)
+}
+
+// lfsEndpoint is the LFS server, e.g. "https://github.com/owner/repo.git/info/lfs".
+// The credentials are sent to the batch API only, since the objects are often served by other hosts.
+type lfsEndpoint struct {
+	url      string
+	client   *http.Client
+	username string
+	password string
+}
+
+type lfsPointer struct {
+	oid  string
+	size int64
+}
+
+// parseLFSPointer returns the pointer if data is a Git LFS pointer file.
+func parseLFSPointer(data []byte) (*lfsPointer, bool) {
+	if len(data) > lfsPointerMaxSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return nil, false
+	}
+	p := &lfsPointer{size: -1}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")[1:] {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 {
+			return nil, false
+		}
+		switch kv[0] {
+		case "oid":
+			oid := strings.TrimPrefix(kv[1], "sha256:")
+			if oid == kv[1] || len(oid) != 64 {
+				return nil, false
+			}
+			if _, err := hex.DecodeString(oid); err != nil {
+				return nil, false
+			}
+			p.oid = oid
+		case "size":
+			size, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, false
+			}
+			p.size = size
+		}
+	}
+	if p.oid == "" || p.size < 0 {
+		return nil, false
+	}
+	return p, true
+}
+
+// resolveLFS replaces the data of the Git LFS pointer files with the objects.
+func (in *Injector) resolveLFS(ctx context.Context, opt *option, files []*blob) error {
+	pointers := map[*blob]*lfsPointer{}
+	var objects []*lfsPointer
+	seen := map[string]bool{}
+	for _, file := range files {
+		p, ok := parseLFSPointer(file.data)
+		if !ok {
+			continue
+		}
+		// Check the size in advance not to download the large objects.
+		if p.size > int64(in.maxSize) {
+			return fmt.Errorf("%s is %d bytes, which exceeds the maximum size %d bytes", file.path, p.size, in.maxSize)
+		}
+		pointers[file] = p
+		if !seen[p.oid] {
+			seen[p.oid] = true
+			objects = append(objects, p)
+		}
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	repo, ok := in.repositories[opt.provider].(lfsRepository)
+	if !ok {
+		return fmt.Errorf("Git LFS is not supported for %s", opt.provider)
+	}
+	ep, err := repo.lfsEndpoint(ctx, opt)
+	if err != nil {
+		return err
+	}
+	data, err := ep.download(ctx, objects)
+	if err != nil {
+		return err
+	}
+	for file, p := range pointers {
+		file.data = data[p.oid]
+	}
+	return nil
+}
+
+type lfsBatchRequest struct {
+	Operation string           `json:"operation"`
+	Transfers []string         `json:"transfers"`
+	Objects   []lfsBatchObject `json:"objects"`
+	HashAlgo  string           `json:"hash_algo"`
+}
+
+type lfsBatchResponse struct {
+	Objects []lfsBatchObject `json:"objects"`
+	Message string           `json:"message"`
+}
+
+type lfsBatchObject struct {
+	OID     string `json:"oid"`
+	Size    int64  `json:"size"`
+	Actions *struct {
+		Download *struct {
+			Href   string            `json:"href"`
+			Header map[string]string `json:"header"`
+		} `json:"download"`
+	} `json:"actions,omitempty"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// download downloads the objects with the basic transfer, and returns the contents keyed by the OIDs.
+func (ep *lfsEndpoint) download(ctx context.Context, objects []*lfsPointer) (map[string][]byte, error) {
+	batch := lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		HashAlgo:  "sha256",
+	}
+	for _, p := range objects {
+		batch.Objects = append(batch.Objects, lfsBatchObject{OID: p.oid, Size: p.size})
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, ep.url+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	if ep.password != "" {
+		req.SetBasicAuth(ep.username, ep.password)
+	}
+	resp, err := ep.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res lfsBatchResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode != http.StatusOK {
+		msg := res.Message
+		if msg == "" {
+			msg = http.StatusText(resp.StatusCode)
+		}
+		return nil, fmt.Errorf("lfs: %d %s", resp.StatusCode, msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lfs: could not decode response: %v", err)
+	}
+
+	sizes := make(map[string]int64, len(objects))
+	for _, p := range objects {
+		sizes[p.oid] = p.size
+	}
+	ret := make(map[string][]byte, len(objects))
+	for _, obj := range res.Objects {
+		size, ok := sizes[obj.OID]
+		if !ok {
+			continue
+		}
+		if obj.Error != nil {
+			return nil, fmt.Errorf("lfs: object %s: %d %s", obj.OID, obj.Error.Code, obj.Error.Message)
+		}
+		if obj.Actions == nil || obj.Actions.Download == nil {
+			return nil, fmt.Errorf("lfs: object %s cannot be downloaded", obj.OID)
+		}
+		data, err := ep.get(ctx, obj.Actions.Download.Href, obj.Actions.Download.Header, size)
+		if err != nil {
+			return nil, fmt.Errorf("lfs: object %s: %v", obj.OID, err)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != size || hex.EncodeToString(sum[:]) != obj.OID {
+			return nil, fmt.Errorf("lfs: object %s is corrupted", obj.OID)
+		}
+		ret[obj.OID] = data
+	}
+	for oid := range sizes {
+		if _, ok := ret[oid]; !ok {
+			return nil, fmt.Errorf("lfs: object %s is not found", oid)
+		}
+	}
+	return ret, nil
+}
+
+func (ep *lfsEndpoint) get(ctx context.Context, href string, header map[string]string, size int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := ep.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	// Read one more byte to detect the objects larger than the pointer says.
+	return ioutil.ReadAll(io.LimitReader(resp.Body, size+1))
+}
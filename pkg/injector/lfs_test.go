@@ -0,0 +1,198 @@
+package injector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func lfsTestPointer(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", lfsPointerVersion, hex.EncodeToString(sum[:]), len(content))
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	oid := strings.Repeat("ab", 32)
+	testCases := []struct {
+		name    string
+		data    string
+		pointer *lfsPointer
+	}{
+		{name: "pointer", data: lfsPointerVersion + "\noid sha256:" + oid + "\nsize 12345\n", pointer: &lfsPointer{oid: oid, size: 12345}},
+		{name: "extension", data: lfsPointerVersion + "\next-0-foo sha256:" + oid + "\noid sha256:" + oid + "\nsize 0\n", pointer: &lfsPointer{oid: oid, size: 0}},
+		{name: "plain file", data: "password: pass\n"},
+		{name: "other version", data: "version https://example.com/spec/v2\noid sha256:" + oid + "\nsize 1\n"},
+		{name: "no oid", data: lfsPointerVersion + "\nsize 1\n"},
+		{name: "no size", data: lfsPointerVersion + "\noid sha256:" + oid + "\n"},
+		{name: "other hash", data: lfsPointerVersion + "\noid sha1:" + oid[:40] + "\nsize 1\n"},
+		{name: "short oid", data: lfsPointerVersion + "\noid sha256:abcd\nsize 1\n"},
+		{name: "invalid oid", data: lfsPointerVersion + "\noid sha256:" + strings.Repeat("zz", 32) + "\nsize 1\n"},
+		{name: "negative size", data: lfsPointerVersion + "\noid sha256:" + oid + "\nsize -1\n"},
+		{name: "invalid line", data: lfsPointerVersion + "\noid sha256:" + oid + "\nsize 1\ninvalid\n"},
+		{name: "large file", data: lfsPointerVersion + "\noid sha256:" + oid + "\nsize 1\n" + strings.Repeat("x", lfsPointerMaxSize)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, ok := parseLFSPointer([]byte(tc.data))
+			if tc.pointer == nil {
+				if ok {
+					t.Errorf("expected not to be a pointer, got %+v", p)
+				}
+				return
+			}
+			if !ok || *p != *tc.pointer {
+				t.Errorf("expected %+v, got %+v", tc.pointer, p)
+			}
+		})
+	}
+}
+
+// lfsTestRepository serves the Git LFS objects in addition to the files of testRepository.
+type lfsTestRepository struct {
+	testRepository
+	endpoint *lfsEndpoint
+}
+
+func (r *lfsTestRepository) lfsEndpoint(ctx context.Context, opt *option) (*lfsEndpoint, error) {
+	return r.endpoint, nil
+}
+
+// newLFSTestServer serves the batch API at /objects/batch and the objects at /objects/<oid>.
+// The objects are keyed by the OIDs, and the contents may not match the OIDs to test the verification.
+func newLFSTestServer(t *testing.T, objects map[string]string) *httptest.Server {
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/objects/batch" {
+			// The credentials of the batch API are not sent to the object storage.
+			if _, _, ok := r.BasicAuth(); ok || r.Header.Get("X-Object-Token") != "token" {
+				t.Errorf("unexpected headers of the download: %v", r.Header)
+			}
+			content, ok := objects[strings.TrimPrefix(r.URL.Path, "/objects/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(content))
+			return
+		}
+
+		user, password, ok := r.BasicAuth()
+		if r.Method != http.MethodPost || !ok || user != "user" || password != "password" ||
+			r.Header.Get("Accept") != lfsMediaType || r.Header.Get("Content-Type") != lfsMediaType {
+			t.Errorf("unexpected batch request: %s %v", r.Method, r.Header)
+		}
+		var req lfsBatchRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			t.Error(err)
+		}
+		if req.Operation != "download" || req.HashAlgo != "sha256" || len(req.Transfers) != 1 || req.Transfers[0] != "basic" {
+			t.Errorf("unexpected batch request: %+v", req)
+		}
+
+		res := map[string]interface{}{}
+		var objs []interface{}
+		requested := map[string]bool{}
+		for _, obj := range req.Objects {
+			if requested[obj.OID] {
+				t.Errorf("object %s is requested twice", obj.OID)
+			}
+			requested[obj.OID] = true
+			if _, ok := objects[obj.OID]; !ok {
+				objs = append(objs, map[string]interface{}{
+					"oid": obj.OID, "size": obj.Size, "error": map[string]interface{}{"code": 404, "message": "Object does not exist"},
+				})
+				continue
+			}
+			objs = append(objs, map[string]interface{}{
+				"oid": obj.OID, "size": obj.Size,
+				"actions": map[string]interface{}{
+					"download": map[string]interface{}{
+						"href":   s.URL + "/objects/" + obj.OID,
+						"header": map[string]string{"X-Object-Token": "token"},
+					},
+				},
+			})
+		}
+		res["objects"] = objs
+		w.Header().Set("Content-Type", lfsMediaType)
+		json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestResolveLFS(t *testing.T) {
+	const content = "password: pass\n"
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	otherSum := sha256.Sum256([]byte("other"))
+	otherOID := hex.EncodeToString(otherSum[:])
+
+	testCases := []struct {
+		name    string
+		objects map[string]string
+		maxSize int
+		err     string
+	}{
+		{name: "download", objects: map[string]string{oid: content}},
+		{name: "sha256 mismatch", objects: map[string]string{oid: strings.Replace(content, "pass", "fail", 1)}, err: "corrupted"},
+		{name: "larger object", objects: map[string]string{oid: content + "x"}, err: "corrupted"},
+		{name: "smaller object", objects: map[string]string{oid: content[1:]}, err: "corrupted"},
+		{name: "missing object", objects: map[string]string{otherOID: "other"}, err: "Object does not exist"},
+		// The objects larger than the maximum size are not downloaded.
+		{name: "too large", objects: map[string]string{}, maxSize: len(content) - 1, err: "exceeds the maximum size"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newLFSTestServer(t, tc.objects)
+			in := newTestInjector(nil)
+			if tc.maxSize != 0 {
+				in.maxSize = tc.maxSize
+			}
+			in.repositories[providerGitHub] = &lfsTestRepository{
+				endpoint: &lfsEndpoint{url: s.URL, client: s.Client(), username: "user", password: "password"},
+			}
+			pointer := lfsTestPointer(content)
+			files := []*blob{
+				{path: "a.yaml", data: []byte(pointer)},
+				// The same object is requested once.
+				{path: "b.yaml", data: []byte(pointer)},
+				{path: "plain.yaml", data: []byte("plain: text\n")},
+			}
+			err := in.resolveLFS(context.Background(), &option{provider: providerGitHub}, files)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files[:2] {
+				if string(file.data) != content {
+					t.Errorf("expected %s to be resolved, got %q", file.path, file.data)
+				}
+			}
+			if string(files[2].data) != "plain: text\n" {
+				t.Errorf("expected plain.yaml not to be changed, got %q", files[2].data)
+			}
+		})
+	}
+}
+
+func TestResolveLFSUnsupported(t *testing.T) {
+	in := newTestInjector(nil)
+	files := []*blob{{path: "a.yaml", data: []byte(lfsTestPointer("content"))}}
+	err := in.resolveLFS(context.Background(), &option{provider: providerGitHub}, files)
+	if err == nil || !strings.Contains(err.Error(), "Git LFS is not supported") {
+		t.Errorf("expected Git LFS not to be supported, got %v", err)
+	}
+}
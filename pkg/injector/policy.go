@@ -0,0 +1,163 @@
+package injector
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// PolicyKey is the key of the ConfigMap which holds the repository policy.
+const PolicyKey = "policy.yaml"
+
+// policy declares which sources each namespace may reference.
+//
+//	rules:
+//	- namespaces: ["team-a-*"]
+//	  namespaceSelector:
+//	    matchLabels:
+//	      team: a
+//	  repositories: ["team-a-org/*"]
+//	  branches: ["main", "release-*"]
+//	  paths: ["secrets/"]
+//
+// A request is allowed when any rule applied to the namespace allows it.
+type policy struct {
+	Rules []policyRule `json:"rules"`
+}
+
+// policyRule is applied to the namespaces which match Namespaces or NamespaceSelector.
+// The rule is applied to all namespaces when both of them are empty.
+type policyRule struct {
+	// Namespaces are the glob patterns of the namespace names.
+	Namespaces        []string              `json:"namespaces,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Providers are the allowed providers. Empty means all providers.
+	Providers []string `json:"providers,omitempty"`
+	// Repositories are the glob patterns of the allowed repositories, in the same form as the annotation.
+	Repositories []string `json:"repositories"`
+	// Branches are the glob patterns of the allowed branches, tags or commit SHAs.
+	// The default branch is represented as "HEAD". Empty means all branches.
+	Branches []string `json:"branches,omitempty"`
+	// Paths are the allowed path prefixes. Empty means all paths.
+	Paths []string `json:"paths,omitempty"`
+}
+
+func (r *policyRule) appliesTo(ns *corev1.Namespace) (bool, error) {
+	if len(r.Namespaces) == 0 && r.NamespaceSelector == nil {
+		return true, nil
+	}
+	if len(r.Namespaces) != 0 && matchAny(r.Namespaces, ns.Name) {
+		return true, nil
+	}
+	if r.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(r.NamespaceSelector)
+		if err != nil {
+			return false, err
+		}
+		return selector.Matches(labels.Set(ns.Labels)), nil
+	}
+	return false, nil
+}
+
+func (r *policyRule) allows(opt *option) bool {
+	if len(r.Providers) != 0 && !containsString(r.Providers, opt.provider) {
+		return false
+	}
+	if len(r.Repositories) == 0 || !matchAny(r.Repositories, opt.repository) {
+		return false
+	}
+	if !matchAny(r.Branches, refName(opt, "HEAD")) {
+		return false
+	}
+	return r.allowsPath(opt.source) && (opt.template == "" || r.allowsPath(opt.template))
+}
+
+func (r *policyRule) allowsPath(p string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	for _, prefix := range r.Paths {
+		prefix = strings.Trim(path.Clean("/"+prefix), "/")
+		if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// refName returns the branch, the tag or the commit of opt, or def for the default branch.
+func refName(opt *option, def string) string {
+	for _, v := range []string{opt.branch, opt.tag, opt.commit} {
+		if v != "" {
+			return v
+		}
+	}
+	return def
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// policyChecker checks the requests against the policy in the ConfigMap.
+// The policy is read on every request, so that the changes are applied immediately.
+type policyChecker struct {
+	client    client.Reader
+	configMap types.NamespacedName
+}
+
+func newPolicyChecker(c client.Reader, configMap types.NamespacedName) *policyChecker {
+	return &policyChecker{
+		client:    c,
+		configMap: configMap,
+	}
+}
+
+// check returns deniedError when the policy does not allow the namespace to reference the source.
+func (p *policyChecker) check(ctx context.Context, opt *option) error {
+	cm := &corev1.ConfigMap{}
+	err := p.client.Get(ctx, p.configMap, cm)
+	if err != nil {
+		return err
+	}
+	pol := policy{}
+	err = yaml.UnmarshalStrict([]byte(cm.Data[PolicyKey]), &pol)
+	if err != nil {
+		return fmt.Errorf("invalid policy in %s: %v", p.configMap, err)
+	}
+
+	ns := &corev1.Namespace{}
+	err = p.client.Get(ctx, types.NamespacedName{Name: opt.namespace}, ns)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range pol.Rules {
+		applied, err := rule.appliesTo(ns)
+		if err != nil {
+			return fmt.Errorf("invalid policy in %s: %v", p.configMap, err)
+		}
+		if applied && rule.allows(opt) {
+			return nil
+		}
+	}
+
+	return &deniedError{
+		reason: fmt.Sprintf("namespace %s is not allowed to reference %s (%s) in %s %s by the policy",
+			opt.namespace, opt.source, refName(opt, "default branch"), opt.provider, opt.repository),
+	}
+}
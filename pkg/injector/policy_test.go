@@ -0,0 +1,165 @@
+package injector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const testPolicy = `
+rules:
+- namespaces: ["team-a-*"]
+  repositories: ["team-a-org/*"]
+  branches: ["main", "release-*"]
+  paths: ["secrets/"]
+- namespaceSelector:
+    matchLabels:
+      team: b
+  providers: ["gitlab"]
+  repositories: ["group/team-b/*"]
+`
+
+func newTestPolicyClient(policy string) client.Client {
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	return fake.NewFakeClient(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "secret-injector", Name: "policy"},
+			Data:       map[string]string{PolicyKey: policy},
+		},
+		namespace("team-a-dev", nil),
+		namespace("team-b-dev", map[string]string{"team": "b"}),
+		namespace("team-a-b", map[string]string{"team": "b"}),
+		namespace("other", nil),
+	)
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := newPolicyChecker(newTestPolicyClient(testPolicy), types.NamespacedName{Namespace: "secret-injector", Name: "policy"})
+
+	teamA := func(modify func(opt *option)) *option {
+		opt := &option{namespace: "team-a-dev", provider: providerGitHub, repository: "team-a-org/app", branch: "main", source: "secrets/db.yaml"}
+		if modify != nil {
+			modify(opt)
+		}
+		return opt
+	}
+	teamB := func(modify func(opt *option)) *option {
+		opt := &option{namespace: "team-b-dev", provider: providerGitLab, repository: "group/team-b/app", source: "db.yaml"}
+		if modify != nil {
+			modify(opt)
+		}
+		return opt
+	}
+	testCases := []struct {
+		name    string
+		opt     *option
+		allowed bool
+	}{
+		{name: "namespace glob", opt: teamA(nil), allowed: true},
+		{name: "other namespace", opt: teamA(func(opt *option) { opt.namespace = "other" })},
+		{name: "other repository", opt: teamA(func(opt *option) { opt.repository = "team-b-org/app" })},
+		{name: "branch glob", opt: teamA(func(opt *option) { opt.branch = "release-1.0" }), allowed: true},
+		{name: "default branch", opt: teamA(func(opt *option) { opt.branch = "" })},
+		{name: "tag", opt: teamA(func(opt *option) { opt.branch, opt.tag = "", "v1" })},
+		{name: "path prefix", opt: teamA(func(opt *option) { opt.source = "secrets" }), allowed: true},
+		{name: "sibling path", opt: teamA(func(opt *option) { opt.source = "secrets-old/db.yaml" })},
+		{name: "other path", opt: teamA(func(opt *option) { opt.source = "db.yaml" })},
+		{name: "template in the paths", opt: teamA(func(opt *option) { opt.template = "secrets/dsn.tmpl" }), allowed: true},
+		{name: "template out of the paths", opt: teamA(func(opt *option) { opt.template = "templates/dsn.tmpl" })},
+		{name: "namespace selector", opt: teamB(nil), allowed: true},
+		{name: "any branch", opt: teamB(func(opt *option) { opt.tag = "v1" }), allowed: true},
+		{name: "other provider", opt: teamB(func(opt *option) { opt.provider = providerGitHub })},
+		{name: "nested group glob", opt: teamB(func(opt *option) { opt.repository = "group/team-b/sub/app" })},
+		{name: "namespace not selected", opt: teamB(func(opt *option) { opt.namespace = "team-a-dev" })},
+		// Any rule applied to the namespace may allow the request.
+		{name: "both rules", opt: teamB(func(opt *option) { opt.namespace = "team-a-b" }), allowed: true},
+		{name: "both rules by name", opt: teamA(func(opt *option) { opt.namespace = "team-a-b" }), allowed: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.check(context.Background(), tc.opt)
+			if tc.allowed {
+				if err != nil {
+					t.Errorf("expected to be allowed, got %v", err)
+				}
+				return
+			}
+			var denied *deniedError
+			if !errors.As(err, &denied) {
+				t.Errorf("expected deniedError, got %v", err)
+			}
+		})
+	}
+
+	// The unknown fields are rejected not to ignore the misspelled restrictions.
+	invalid := newPolicyChecker(newTestPolicyClient("rules:\n- namespace: [team-a-*]\n  repositories: ['*']\n"),
+		types.NamespacedName{Namespace: "secret-injector", Name: "policy"})
+	err := invalid.check(context.Background(), teamA(nil))
+	if err == nil || !strings.Contains(err.Error(), "invalid policy") {
+		t.Errorf("expected the unknown field to be rejected, got %v", err)
+	}
+}
+
+func TestHandlePolicy(t *testing.T) {
+	in := newTestInjector(map[string]string{"secrets/db.yaml": "password: pass\n"})
+	in.policy = newPolicyChecker(newTestPolicyClient(testPolicy), types.NamespacedName{Namespace: "secret-injector", Name: "policy"})
+	decoder, err := admission.NewDecoder(runtime.NewScheme())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = in.InjectDecoder(decoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(namespace string) admission.Request {
+		sec := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      "db",
+				Labels:    map[string]string{WebhookTargetKey: "true"},
+				Annotations: map[string]string{
+					RepoNameKey:   "team-a-org/app",
+					BranchNameKey: "main",
+					SourcePathKey: "/secrets/db.yaml",
+				},
+			},
+		}
+		raw, err := json.Marshal(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Namespace: namespace,
+			Name:      sec.Name,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	resp := in.Handle(context.Background(), request("other"))
+	if resp.Allowed || resp.Result.Code != http.StatusForbidden {
+		t.Errorf("expected the request to be denied, got %+v", resp.AdmissionResponse)
+	}
+	if !strings.Contains(resp.Result.Message+string(resp.Result.Reason), "namespace other is not allowed") {
+		t.Errorf("expected the reason, got %+v", resp.Result)
+	}
+
+	resp = in.Handle(context.Background(), request("team-a-dev"))
+	if !resp.Allowed || len(resp.Patches) == 0 {
+		t.Errorf("expected the Secret to be patched, got %+v", resp.AdmissionResponse)
+	}
+}
@@ -0,0 +1,188 @@
+package injector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-github/v30/github"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxPushPayloadSize is the maximum size of a push event payload. GitHub caps the payloads at 25 MB.
+const maxPushPayloadSize = 25 << 20
+
+// maxPushCommits is the maximum number of the commits in a push event payload.
+const maxPushCommits = 2048
+
+// PushHandler receives GitHub push events, and resyncs the Secrets referencing the pushed files immediately.
+type PushHandler struct {
+	client     client.Reader
+	reconciler *SecretReconciler
+	secret     []byte
+	log        logr.Logger
+}
+
+// NewPushHandler creates the new PushHandler.
+// secret is the webhook secret used to verify the X-Hub-Signature-256 header.
+func NewPushHandler(c client.Reader, reconciler *SecretReconciler, secret []byte, log logr.Logger) *PushHandler {
+	return &PushHandler{
+		client:     c,
+		reconciler: reconciler,
+		secret:     secret,
+		log:        log.WithName("push"),
+	}
+}
+
+func (h *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPushPayloadSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.validSignature(r.Header.Get("X-Hub-Signature-256"), body) {
+		h.log.Info("Invalid signature", "delivery", r.Header.Get("X-GitHub-Delivery"))
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Header.Get("X-GitHub-Event") {
+	case "ping":
+		w.WriteHeader(http.StatusOK)
+		return
+	case "push":
+	default:
+		// Ignore the other events.
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	payload, err := pushPayload(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ev := &github.PushEvent{}
+	err = json.Unmarshal(payload, ev)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secrets := &corev1.SecretList{}
+	err = h.client.List(r.Context(), secrets, client.MatchingLabels{WebhookTargetKey: "true"})
+	if err != nil {
+		h.log.Error(err, "Could not list Secrets")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range secrets.Items {
+		sec := &secrets.Items[i]
+		opt, err := h.reconciler.injector.decodeAnnotations(sec)
+		if err != nil || !pushAffects(ev, opt) {
+			continue
+		}
+		h.log.Info("Resyncing Secret", "namespace", sec.Namespace, "name", sec.Name, "repository", ev.GetRepo().GetFullName())
+		err = h.reconciler.resync(r.Context(), sec)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *PushHandler) validSignature(signature string, body []byte) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// pushPayload returns the JSON payload of the delivery, which is sent as either JSON or a form.
+func pushPayload(contentType string, body []byte) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/x-www-form-urlencoded" {
+		return body, nil
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(form.Get("payload")), nil
+}
+
+// pushAffects returns true if the push event changes any of the sources specified by opt.
+func pushAffects(ev *github.PushEvent, opt *option) bool {
+	paths := []string{opt.source}
+	if opt.template != "" {
+		paths = append(paths, opt.template)
+	}
+	if pushAffectsSource(ev, opt, paths) {
+		return true
+	}
+	for _, sub := range opt.sources {
+		if pushAffectsSource(ev, sub, []string{sub.source}) {
+			return true
+		}
+	}
+	return false
+}
+
+// pushAffectsSource returns true if the push event changes any of the paths in the repository specified by opt.
+func pushAffectsSource(ev *github.PushEvent, opt *option, paths []string) bool {
+	if opt.provider != providerGitHub {
+		return false
+	}
+	if !strings.EqualFold(ev.GetRepo().GetFullName(), opt.owner+"/"+opt.repo) {
+		return false
+	}
+	// Sources pinned to a commit never change.
+	if opt.commit != "" {
+		return false
+	}
+	ref := opt.ref()
+	if ref == "" {
+		ref = "refs/heads/" + ev.GetRepo().GetDefaultBranch()
+	}
+	if ev.GetRef() != ref {
+		return false
+	}
+
+	// The changes cannot be known from the list of the commits when it is empty or truncated,
+	// or when the push is forced, since the files changed by the discarded commits are not listed.
+	if len(ev.Commits) == 0 || len(ev.Commits) >= maxPushCommits || ev.GetSize() > len(ev.Commits) || ev.GetForced() {
+		return true
+	}
+	for _, commit := range ev.Commits {
+		for _, files := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+			for _, file := range files {
+				for _, p := range paths {
+					if p == "" || file == p || strings.HasPrefix(file, p+"/") {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package injector
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/go-github/v30/github"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const pushTestSecret = "webhook-secret"
+
+func signPush(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func pushTestSecretObject(name string, annotations map[string]string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Labels:      map[string]string{WebhookTargetKey: "true"},
+			Annotations: annotations,
+		},
+	}
+}
+
+// TestPushHandler posts the recorded payload in testdata/push/push.json, which modifies app/database.yaml
+// on the default branch of Codertocat/secrets.
+func TestPushHandler(t *testing.T) {
+	payload := readTestData(t, "push", "push.json")
+	form := []byte(url.Values{"payload": {string(payload)}}.Encode())
+
+	testCases := []struct {
+		name        string
+		event       string
+		contentType string
+		body        []byte
+		signature   string
+		status      int
+		resynced    []string
+	}{
+		{
+			name:        "json",
+			event:       "push",
+			contentType: "application/json",
+			body:        payload,
+			signature:   signPush(pushTestSecret, payload),
+			status:      http.StatusOK,
+			resynced:    []string{"default-branch", "directory"},
+		},
+		{
+			name:        "form",
+			event:       "push",
+			contentType: "application/x-www-form-urlencoded",
+			body:        form,
+			signature:   signPush(pushTestSecret, form),
+			status:      http.StatusOK,
+			resynced:    []string{"default-branch", "directory"},
+		},
+		{
+			name:        "ping",
+			event:       "ping",
+			contentType: "application/json",
+			body:        []byte(`{"zen":"Keep it logically awesome."}`),
+			signature:   signPush(pushTestSecret, []byte(`{"zen":"Keep it logically awesome."}`)),
+			status:      http.StatusOK,
+		},
+		{
+			name:        "wrong secret",
+			event:       "push",
+			contentType: "application/json",
+			body:        payload,
+			signature:   signPush("wrong", payload),
+			status:      http.StatusUnauthorized,
+		},
+		{
+			name:        "no signature",
+			event:       "push",
+			contentType: "application/json",
+			body:        payload,
+			status:      http.StatusUnauthorized,
+		},
+		{
+			name:        "modified payload",
+			event:       "push",
+			contentType: "application/json",
+			body:        append(payload[:len(payload):len(payload)], ' '),
+			signature:   signPush(pushTestSecret, payload),
+			status:      http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fake.NewFakeClient(
+				pushTestSecretObject("default-branch", map[string]string{
+					RepoNameKey:   "Codertocat/secrets",
+					SourcePathKey: "app/database.yaml",
+				}),
+				pushTestSecretObject("directory", map[string]string{
+					RepoNameKey:   "codertocat/secrets",
+					BranchNameKey: "main",
+					SourcePathKey: "app",
+				}),
+				pushTestSecretObject("other-file", map[string]string{
+					RepoNameKey:   "Codertocat/secrets",
+					SourcePathKey: "app/cache.yaml",
+				}),
+				pushTestSecretObject("other-branch", map[string]string{
+					RepoNameKey:   "Codertocat/secrets",
+					BranchNameKey: "release",
+					SourcePathKey: "app/database.yaml",
+				}),
+				pushTestSecretObject("pinned", map[string]string{
+					RepoNameKey:   "Codertocat/secrets",
+					CommitKey:     "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+					SourcePathKey: "app/database.yaml",
+				}),
+			)
+			in := &Injector{repositories: map[string]repository{providerGitHub: nil}}
+			reconciler := NewSecretReconciler(c, in, 0, log.NullLogger{})
+			h := NewPushHandler(c, reconciler, []byte(pushTestSecret), log.NullLogger{})
+
+			req := httptest.NewRequest(http.MethodPost, "/github/push", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			req.Header.Set("X-GitHub-Event", tc.event)
+			if tc.signature != "" {
+				req.Header.Set("X-Hub-Signature-256", tc.signature)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tc.status {
+				t.Errorf("expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+
+			var resynced []string
+			for len(reconciler.events) > 0 {
+				ev := <-reconciler.events
+				resynced = append(resynced, ev.Meta.GetName())
+			}
+			sort.Strings(resynced)
+			if !reflect.DeepEqual(resynced, tc.resynced) {
+				t.Errorf("expected %v to be resynced, got %v", tc.resynced, resynced)
+			}
+		})
+	}
+}
+
+func TestPushAffectsSource(t *testing.T) {
+	opt := &option{provider: providerGitHub, owner: "org", repo: "repo", source: "app/database.yaml"}
+	paths := []string{opt.source}
+	commit := func(modified ...string) *github.HeadCommit {
+		return &github.HeadCommit{Modified: modified}
+	}
+	event := func(commits ...*github.HeadCommit) *github.PushEvent {
+		return &github.PushEvent{
+			Ref:     github.String("refs/heads/main"),
+			Repo:    &github.PushEventRepository{FullName: github.String("org/repo"), DefaultBranch: github.String("main")},
+			Commits: commits,
+		}
+	}
+
+	unrelated := event(commit("README.md"))
+	if pushAffectsSource(unrelated, opt, paths) {
+		t.Error("unrelated push affects the source")
+	}
+	if !pushAffectsSource(event(commit("README.md"), commit("app/database.yaml")), opt, paths) {
+		t.Error("push modifying the source does not affect it")
+	}
+
+	empty := event()
+	if !pushAffectsSource(empty, opt, paths) {
+		t.Error("push without commits does not affect the source")
+	}
+	truncated := event(commit("README.md"))
+	truncated.Size = github.Int(30)
+	if !pushAffectsSource(truncated, opt, paths) {
+		t.Error("push with truncated commits does not affect the source")
+	}
+	large := event()
+	for i := 0; i < maxPushCommits; i++ {
+		large.Commits = append(large.Commits, commit("README.md"))
+	}
+	if !pushAffectsSource(large, opt, paths) {
+		t.Error("push with the maximum number of commits does not affect the source")
+	}
+	forced := event(commit("README.md"))
+	forced.Forced = github.Bool(true)
+	if !pushAffectsSource(forced, opt, paths) {
+		t.Error("forced push does not affect the source")
+	}
+}
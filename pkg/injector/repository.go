@@ -0,0 +1,53 @@
+package injector
+
+import (
+	"context"
+)
+
+// Provider names
+const (
+	providerGitHub = "github"
+	providerGitLab = "gitlab"
+	providerGit    = "git"
+)
+
+// repository is a backend which serves the contents of a repository.
+type repository interface {
+	// resolve resolves the branch, the tag or the commit specified by opt to the commit.
+	resolve(ctx context.Context, opt *option) (*revision, error)
+	// getContents returns the file at path in the commit.
+	// If path is a directory, it returns the files directly under the directory instead,
+	// or all the files in the subdirectories as well if opt.recursive is set.
+	getContents(ctx context.Context, opt *option, commit, path string) (*blob, []*blob, error)
+}
+
+// revision is the commit which the source is read from.
+type revision struct {
+	// ref is the fully qualified name of the branch or the tag (e.g. refs/heads/main).
+	// It is empty when the source is pinned to a commit.
+	ref    string
+	commit string
+	// tag is the SHA of the annotated tag object when ref is an annotated tag.
+	tag string
+}
+
+// blob is a file in a repository.
+type blob struct {
+	name string
+	path string
+	sha  string
+	data []byte
+}
+
+// isFullSHA returns true if s is a full hexadecimal object name of SHA-1 or SHA-256.
+func isFullSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package injector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	injectorv1alpha1 "github.com/masa213f/secret-injector/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SecretSourceReconciler generates the Secrets from SecretSources, and keeps them in sync with the repositories.
+type SecretSourceReconciler struct {
+	client   client.Client
+	scheme   *runtime.Scheme
+	injector *Injector
+	interval time.Duration
+	log      logr.Logger
+}
+
+// NewSecretSourceReconciler creates the new SecretSourceReconciler which re-fetches the sources every interval.
+// If interval is zero, the sources are fetched only when SecretSources are changed.
+func NewSecretSourceReconciler(c client.Client, scheme *runtime.Scheme, injector *Injector, interval time.Duration, log logr.Logger) *SecretSourceReconciler {
+	return &SecretSourceReconciler{
+		client:   c,
+		scheme:   scheme,
+		injector: injector,
+		interval: interval,
+		log:      log.WithName("secretsource"),
+	}
+}
+
+// SetupWithManager registers the reconciler to the manager.
+func (r *SecretSourceReconciler) SetupWithManager(mgr manager.Manager) error {
+	return builder.ControllerManagedBy(mgr).
+		For(&injectorv1alpha1.SecretSource{}).
+		Owns(&corev1.Secret{}).
+		WithEventFilter(predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				// Ignore the status updates made by the reconciler itself.
+				// The owned Secrets have no generation, so their changes always pass.
+				if _, ok := e.ObjectNew.(*injectorv1alpha1.SecretSource); ok {
+					return e.MetaNew.GetGeneration() != e.MetaOld.GetGeneration()
+				}
+				return true
+			},
+		}).
+		Complete(r)
+}
+
+// Reconcile fetches the source of the SecretSource, and creates or updates the Secret.
+func (r *SecretSourceReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	log := r.log.WithValues("namespace", req.Namespace, "name", req.Name)
+
+	ss := &injectorv1alpha1.SecretSource{}
+	err := r.client.Get(ctx, req.NamespacedName, ss)
+	if apierrors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if ss.DeletionTimestamp != nil {
+		return reconcile.Result{}, nil
+	}
+
+	syncErr := r.sync(ctx, ss)
+	if syncErr != nil {
+		log.Error(syncErr, "Could not sync SecretSource")
+		ss.Status.Error = syncErr.Error()
+	} else {
+		ss.Status.Error = ""
+	}
+	ss.Status.ObservedGeneration = ss.Generation
+	err = r.client.Status().Update(ctx, ss)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if syncErr != nil {
+		return reconcile.Result{}, syncErr
+	}
+	return reconcile.Result{RequeueAfter: r.interval}, nil
+}
+
+// specOption creates the option from the spec.
+func specOption(spec *injectorv1alpha1.SecretSourceSpec) *option {
+	opt := &option{
+		provider:   spec.Provider,
+		repository: spec.Repository,
+		branch:     spec.Ref,
+		tag:        spec.Tag,
+		commit:     spec.Commit,
+		source:     spec.Path,
+		format:     spec.Format,
+		nested:     spec.Nested,
+		separator:  spec.KeySeparator,
+		selectPath: spec.Select,
+		include:    spec.Include,
+		exclude:    spec.Exclude,
+		keyPrefix:  spec.KeyPrefix,
+		keySuffix:  spec.KeySuffix,
+		rename:     spec.Rename,
+		recursive:  spec.Recursive,
+		template:   spec.Template,
+		conflict:   spec.Conflict,
+		prune:      spec.Prune,
+	}
+	for i := range spec.Sources {
+		opt.sources = append(opt.sources, sourceRefOption(&spec.Sources[i]))
+	}
+	return opt
+}
+
+// sync updates the Secret and the status of ss except for the error.
+func (r *SecretSourceReconciler) sync(ctx context.Context, ss *injectorv1alpha1.SecretSource) error {
+	spec := ss.Spec
+	opt := specOption(&spec)
+	err := r.injector.validateOption(opt)
+	if err != nil {
+		return err
+	}
+	opt.namespace = ss.Namespace
+
+	src, err := r.injector.fetch(ctx, opt, true)
+	if err != nil {
+		return err
+	}
+
+	name := spec.Target.Name
+	if name == "" {
+		name = ss.Name
+	}
+	sec := &corev1.Secret{}
+	sec.Namespace = ss.Namespace
+	sec.Name = name
+	_, err = controllerutil.CreateOrUpdate(ctx, r.client, sec, func() error {
+		if sec.CreationTimestamp.IsZero() {
+			sec.Type = spec.Target.Type
+		} else if !metav1.IsControlledBy(sec, ss) {
+			return fmt.Errorf("secret %s already exists and is not managed by the SecretSource", name)
+		} else if spec.Target.Type != "" && sec.Type != spec.Target.Type {
+			return fmt.Errorf("secret %s has the type %s instead of %s", name, sec.Type, spec.Target.Type)
+		}
+		err := r.injector.applySource(sec, src, spec.Prune)
+		if err != nil {
+			return err
+		}
+		return controllerutil.SetControllerReference(ss, sec, r.scheme)
+	})
+	if err != nil {
+		return err
+	}
+
+	ss.Status.Commit = src.rev.commit
+	ss.Status.Ref = src.rev.ref
+	ss.Status.SHA = src.fileHash
+	ss.Status.Files = src.dirHash
+	now := metav1.Now()
+	ss.Status.LastSyncTime = &now
+	return nil
+}
@@ -0,0 +1,290 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+	sshSignatureFooter = "-----END SSH SIGNATURE-----"
+
+	// sshSignatureNamespace is the namespace git uses to sign the commits and the tags.
+	sshSignatureNamespace = "git"
+)
+
+// signedObject is a commit or a tag object split into the signed payload and the signature.
+type signedObject struct {
+	payload []byte
+	// signature is empty when the object is not signed.
+	signature []byte
+}
+
+// signatureReader is implemented by the repositories which can read the signatures of the objects.
+type signatureReader interface {
+	// readSigned returns the commit or the tag object (objType is "commit" or "tag") named by sha.
+	readSigned(ctx context.Context, opt *option, objType, sha string) (*signedObject, error)
+}
+
+// signatureVerifier verifies the GPG and SSH signatures made by the trusted keys.
+type signatureVerifier struct {
+	pgpKeys openpgp.EntityList
+	sshKeys []ssh.PublicKey
+}
+
+// newSignatureVerifier reads the trusted keys from the GPG keyring and the SSH allowed signers file.
+// Either of the files can be empty.
+func newSignatureVerifier(pgpKeyringFile, sshAllowedSignersFile string) (*signatureVerifier, error) {
+	v := &signatureVerifier{}
+	if pgpKeyringFile != "" {
+		data, err := ioutil.ReadFile(pgpKeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(data, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+			v.pgpKeys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		} else {
+			v.pgpKeys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyring %s: %v", pgpKeyringFile, err)
+		}
+	}
+	if sshAllowedSignersFile != "" {
+		data, err := ioutil.ReadFile(sshAllowedSignersFile)
+		if err != nil {
+			return nil, err
+		}
+		v.sshKeys, err = parseSSHAllowedSigners(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed signers %s: %v", sshAllowedSignersFile, err)
+		}
+	}
+	if len(v.pgpKeys) == 0 && len(v.sshKeys) == 0 {
+		return nil, errors.New("no trusted keys for the signature verification")
+	}
+	return v, nil
+}
+
+// parseSSHAllowedSigners parses the keys in the allowed signers format of ssh-keygen or the authorized_keys format.
+// The principals and the options are ignored, because a commit signature is trusted regardless of the committer.
+func parseSSHAllowedSigners(data []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			// Skip the principals.
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 {
+				return nil, err
+			}
+			key, _, _, _, err = ssh.ParseAuthorizedKey([]byte(fields[1]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// verify returns nil if signature is a valid signature of payload made by a trusted key.
+func (v *signatureVerifier) verify(payload, signature []byte) error {
+	switch {
+	case len(signature) == 0:
+		return errors.New("not signed")
+	case bytes.HasPrefix(signature, []byte(pgpSignatureHeader)):
+		if len(v.pgpKeys) == 0 {
+			return errors.New("no trusted gpg keys")
+		}
+		_, err := openpgp.CheckArmoredDetachedSignature(v.pgpKeys, bytes.NewReader(payload), bytes.NewReader(signature))
+		return err
+	case bytes.HasPrefix(signature, []byte(sshSignatureHeader)):
+		if len(v.sshKeys) == 0 {
+			return errors.New("no trusted ssh keys")
+		}
+		return v.verifySSH(payload, signature)
+	}
+	return errors.New("unknown signature format")
+}
+
+// sshSignature is the SSHSIG format defined in PROTOCOL.sshsig of OpenSSH, following the magic preamble.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is the data actually signed by the key, following the magic preamble.
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func (v *signatureVerifier) verifySSH(payload, armored []byte) error {
+	text := strings.TrimSpace(string(armored))
+	if !strings.HasSuffix(text, sshSignatureFooter) {
+		return errors.New("invalid ssh signature armor")
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, sshSignatureHeader), sshSignatureFooter)
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return err
+	}
+
+	const magic = "SSHSIG"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return errors.New("invalid ssh signature")
+	}
+	var sig sshSignature
+	err = ssh.Unmarshal(data[len(magic):], &sig)
+	if err != nil {
+		return err
+	}
+	if sig.Version != 1 {
+		return fmt.Errorf("unsupported ssh signature version: %d", sig.Version)
+	}
+	if sig.Namespace != sshSignatureNamespace {
+		return fmt.Errorf("unexpected ssh signature namespace: %s", sig.Namespace)
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported ssh signature hash algorithm: %s", sig.HashAlgorithm)
+	}
+	h.Write(payload)
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !v.trustedSSHKey(key) {
+		return fmt.Errorf("signed by an untrusted key %s", ssh.FingerprintSHA256(key))
+	}
+	var s ssh.Signature
+	err = ssh.Unmarshal(sig.Signature, &s)
+	if err != nil {
+		return err
+	}
+	signed := append([]byte(magic), ssh.Marshal(sshSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+	return key.Verify(signed, &s)
+}
+
+func (v *signatureVerifier) trustedSSHKey(key ssh.PublicKey) bool {
+	b := key.Marshal()
+	for _, k := range v.sshKeys {
+		if bytes.Equal(k.Marshal(), b) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyRevision checks the annotated tag or the commit of rev is signed by a trusted key.
+// It returns deniedError when neither of them is.
+func (in *Injector) verifyRevision(ctx context.Context, opt *option, rev *revision) error {
+	reader, ok := in.repositories[opt.provider].(signatureReader)
+	if !ok {
+		return &deniedError{
+			reason: fmt.Sprintf("signature verification is not supported for %s", opt.provider),
+		}
+	}
+
+	if rev.tag != "" {
+		obj, err := reader.readSigned(ctx, opt, "tag", rev.tag)
+		if err != nil {
+			return err
+		}
+		if in.verifier.verify(obj.payload, obj.signature) == nil {
+			return nil
+		}
+	}
+
+	obj, err := reader.readSigned(ctx, opt, "commit", rev.commit)
+	if err != nil {
+		return err
+	}
+	err = in.verifier.verify(obj.payload, obj.signature)
+	if err != nil {
+		return &deniedError{
+			reason: fmt.Sprintf("commit %s in %s is not signed by a trusted key: %v", rev.commit, opt.repository, err),
+		}
+	}
+	return nil
+}
+
+// splitCommitSignature splits the raw commit object into the payload and the gpgsig header.
+func splitCommitSignature(raw []byte) *signedObject {
+	var payload, signature bytes.Buffer
+	lines := bytes.SplitAfter(raw, []byte("\n"))
+	inSignature := false
+	for i, line := range lines {
+		if len(bytes.TrimRight(line, "\n")) == 0 {
+			// The end of the headers.
+			for _, l := range lines[i:] {
+				payload.Write(l)
+			}
+			break
+		}
+		if inSignature && bytes.HasPrefix(line, []byte(" ")) {
+			signature.Write(line[1:])
+			continue
+		}
+		inSignature = false
+		if bytes.HasPrefix(line, []byte("gpgsig ")) || bytes.HasPrefix(line, []byte("gpgsig-sha256 ")) {
+			inSignature = true
+			signature.Write(line[bytes.IndexByte(line, ' ')+1:])
+			continue
+		}
+		payload.Write(line)
+	}
+	return &signedObject{
+		payload:   payload.Bytes(),
+		signature: signature.Bytes(),
+	}
+}
+
+// splitTagSignature splits the raw tag object into the payload and the signature appended to the message.
+func splitTagSignature(raw []byte) *signedObject {
+	for _, header := range []string{pgpSignatureHeader, sshSignatureHeader} {
+		i := bytes.LastIndex(raw, []byte("\n"+header))
+		if i >= 0 {
+			return &signedObject{
+				payload:   raw[:i+1],
+				signature: raw[i+1:],
+			}
+		}
+	}
+	return &signedObject{payload: raw}
+}
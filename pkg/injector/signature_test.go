@@ -0,0 +1,136 @@
+package injector
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata/signature are the raw objects written by git. The GPG key trusted.asc and the SSH key
+// in allowed_signers are trusted. The *-untrusted-commit objects are signed by the other keys.
+func newTestSignatureVerifier(t *testing.T) *signatureVerifier {
+	t.Helper()
+	v, err := newSignatureVerifier(
+		filepath.Join("testdata", "signature", "trusted.asc"),
+		filepath.Join("testdata", "signature", "allowed_signers"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSplitCommitSignature(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header string
+	}{
+		{name: "gpg-commit", header: pgpSignatureHeader},
+		{name: "gpg-untrusted-commit", header: pgpSignatureHeader},
+		{name: "ssh-commit", header: sshSignatureHeader},
+		{name: "ssh-untrusted-commit", header: sshSignatureHeader},
+		{name: "unsigned-commit"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := readTestData(t, "signature", tc.name)
+			obj := splitCommitSignature(raw)
+			if tc.header == "" {
+				if len(obj.signature) != 0 {
+					t.Errorf("expected no signature, got %q", obj.signature)
+				}
+				if !bytes.Equal(obj.payload, raw) {
+					t.Errorf("expected %q, got %q", raw, obj.payload)
+				}
+				return
+			}
+			if !bytes.HasPrefix(obj.signature, []byte(tc.header)) {
+				t.Errorf("expected the signature to start with %s, got %q", tc.header, obj.signature)
+			}
+			if bytes.Contains(obj.signature, []byte("\n ")) {
+				t.Errorf("expected the continuation spaces to be removed, got %q", obj.signature)
+			}
+			// The payload is the object without the gpgsig header, which git passes to gpg and ssh-keygen.
+			start := bytes.Index(raw, []byte("gpgsig "))
+			end := bytes.Index(raw, []byte("-----\n\n")) + len("-----\n")
+			expected := append(append([]byte{}, raw[:start]...), raw[end:]...)
+			if !bytes.Equal(obj.payload, expected) {
+				t.Errorf("expected %q, got %q", expected, obj.payload)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	v := newTestSignatureVerifier(t)
+	testCases := []struct {
+		name  string
+		split func([]byte) *signedObject
+		err   string
+	}{
+		{name: "gpg-commit", split: splitCommitSignature},
+		{name: "gpg-tag", split: splitTagSignature},
+		{name: "ssh-commit", split: splitCommitSignature},
+		{name: "ssh-tag", split: splitTagSignature},
+		{name: "unsigned-commit", split: splitCommitSignature, err: "not signed"},
+		{name: "gpg-untrusted-commit", split: splitCommitSignature, err: "signature made by unknown entity"},
+		{name: "ssh-untrusted-commit", split: splitCommitSignature, err: "signed by an untrusted key"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			obj := tc.split(readTestData(t, "signature", tc.name))
+			err := v.verify(obj.payload, obj.signature)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Any change of the payload invalidates the signature.
+				tampered := append([]byte{}, obj.payload...)
+				tampered = bytes.Replace(tampered, []byte("test@example.com"), []byte("evil@example.com"), 1)
+				if v.verify(tampered, obj.signature) == nil {
+					t.Error("verified the signature of a tampered payload")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifySSH(t *testing.T) {
+	v := newTestSignatureVerifier(t)
+	obj := splitCommitSignature(readTestData(t, "signature", "ssh-commit"))
+	err := v.verifySSH(obj.payload, obj.signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	untrusted := splitCommitSignature(readTestData(t, "signature", "ssh-untrusted-commit"))
+	err = v.verifySSH(untrusted.payload, untrusted.signature)
+	if err == nil || !strings.Contains(err.Error(), "untrusted key") {
+		t.Errorf("expected the untrusted key to be rejected, got %v", err)
+	}
+
+	// The signature of the other commit does not match the payload.
+	err = v.verifySSH(obj.payload, untrusted.signature)
+	if err == nil {
+		t.Error("verified the signature of the other commit")
+	}
+
+	truncated := bytes.TrimSuffix(bytes.TrimSpace(obj.signature), []byte(sshSignatureFooter))
+	err = v.verifySSH(obj.payload, truncated)
+	if err == nil || !strings.Contains(err.Error(), "armor") {
+		t.Errorf("expected the invalid armor to be rejected, got %v", err)
+	}
+
+	// The GPG keys do not verify the SSH signatures.
+	gpgOnly := &signatureVerifier{pgpKeys: v.pgpKeys}
+	err = gpgOnly.verify(obj.payload, obj.signature)
+	if err == nil || !strings.Contains(err.Error(), "no trusted ssh keys") {
+		t.Errorf("expected no trusted ssh keys, got %v", err)
+	}
+}
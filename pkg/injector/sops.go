@@ -0,0 +1,317 @@
+package injector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsdotenv "github.com/getsops/sops/v3/stores/dotenv"
+	sopsjson "github.com/getsops/sops/v3/stores/json"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The keys in the key Secret are identified by the suffixes, in the same way as Flux.
+const (
+	sopsAgeKeySuffix = ".agekey"
+	sopsPGPKeySuffix = ".asc"
+)
+
+// sopsKeys are the private keys to decrypt the data keys of the SOPS files.
+type sopsKeys struct {
+	age []age.Identity
+	pgp openpgp.EntityList
+}
+
+// add adds the key in the Secret by the suffix of the name. The other keys are ignored.
+func (k *sopsKeys) add(name string, data []byte) error {
+	var err error
+	switch {
+	case strings.HasSuffix(name, sopsAgeKeySuffix):
+		err = k.addAge(data)
+	case strings.HasSuffix(name, sopsPGPKeySuffix):
+		err = k.addPGP(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+func (k *sopsKeys) addAge(data []byte) error {
+	ids, err := parseAgeIdentities(data)
+	if err != nil {
+		return err
+	}
+	k.age = append(k.age, ids...)
+	return nil
+}
+
+func (k *sopsKeys) addPGP(data []byte) error {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	k.pgp = append(k.pgp, entities...)
+	return nil
+}
+
+// sopsDecryptor decrypts the SOPS files with the age and PGP keys in the files and the Secret.
+type sopsDecryptor struct {
+	keys sopsKeys
+
+	// The keys in the Secret are read on every decryption, so that the rotation is applied immediately.
+	client client.Reader
+	secret types.NamespacedName
+}
+
+// newSOPSDecryptor reads the age identities and the armored PGP private keys from the files.
+// keySecret is the Secret ("namespace/name") holding "*.agekey" and "*.asc" keys. Any of them can be empty.
+func newSOPSDecryptor(c client.Reader, ageKeyFile, pgpKeyFile, keySecret string) (*sopsDecryptor, error) {
+	d := &sopsDecryptor{client: c}
+	for _, f := range []struct {
+		filename string
+		add      func([]byte) error
+	}{
+		{ageKeyFile, d.keys.addAge},
+		{pgpKeyFile, d.keys.addPGP},
+	} {
+		if f.filename == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(f.filename)
+		if err != nil {
+			return nil, err
+		}
+		err = f.add(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in %s: %v", f.filename, err)
+		}
+	}
+	if keySecret != "" {
+		name, err := parseNamespacedName(keySecret)
+		if err != nil {
+			return nil, err
+		}
+		d.secret = name
+	}
+	return d, nil
+}
+
+func (d *sopsDecryptor) loadKeys(ctx context.Context) (*sopsKeys, error) {
+	if d.secret.Name == "" {
+		return &d.keys, nil
+	}
+	sec := &corev1.Secret{}
+	err := d.client.Get(ctx, d.secret, sec)
+	if err != nil {
+		return nil, err
+	}
+	keys := sopsKeys{
+		age: append([]age.Identity(nil), d.keys.age...),
+		pgp: append(openpgp.EntityList(nil), d.keys.pgp...),
+	}
+	for name, data := range sec.Data {
+		err := keys.add(name, data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in secret %s: %v", d.secret, err)
+		}
+	}
+	return &keys, nil
+}
+
+// isSOPSFile returns true if the file in the format is encrypted by SOPS.
+func isSOPSFile(format string, data []byte) bool {
+	if !bytes.Contains(data, []byte("ENC[AES256_GCM,")) {
+		return false
+	}
+	switch format {
+	case formatYAML, formatJSON:
+	case formatDotenv:
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "sops_mac=") {
+				return true
+			}
+		}
+		return false
+	default:
+		// The other formats are not supported by SOPS.
+		return false
+	}
+	var tree yaml.MapSlice
+	if yaml.Unmarshal(data, &tree) != nil {
+		return false
+	}
+	for _, item := range tree {
+		if item.Key == "sops" {
+			_, ok := item.Value.(yaml.MapSlice)
+			return ok
+		}
+	}
+	return false
+}
+
+// decryptAge decrypts the age file with the age identities.
+func (d *sopsDecryptor) decryptAge(ctx context.Context, data []byte) ([]byte, error) {
+	keys, err := d.loadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys.age) == 0 {
+		return nil, errors.New("no age identities are configured")
+	}
+	return ageDecrypt(data, keys.age)
+}
+
+// decrypt decrypts the SOPS file in the format, and returns the plaintext in the same format without the metadata.
+// It follows decrypt.DataWithFormat of SOPS, but decrypts the data key with the configured keys instead of
+// those in the environment. Only age and PGP keys are supported; the files encrypted only with the cloud KMS or
+// Vault keys, and the files with mac_only_encrypted, which SOPS v3.8 does not know, cannot be decrypted.
+func (d *sopsDecryptor) decrypt(ctx context.Context, format string, data []byte) ([]byte, error) {
+	keys, err := d.loadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var store sops.Store
+	switch format {
+	case formatYAML:
+		store = &sopsyaml.Store{}
+	case formatJSON:
+		store = &sopsjson.Store{}
+	case formatDotenv:
+		store = &sopsdotenv.Store{}
+	default:
+		return nil, fmt.Errorf("unsupported sops format: %s", format)
+	}
+
+	if sopsMACOnlyEncrypted(format, data) {
+		return nil, errors.New("mac_only_encrypted is not supported")
+	}
+	tree, err := store.LoadEncryptedFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sops file: %v", err)
+	}
+	key, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{&sopsKeyService{keys: keys}})
+	if err != nil {
+		return nil, fmt.Errorf("none of the configured age or pgp keys can decrypt the data key: %v", err)
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Decrypt(key, cipher)
+	if err != nil {
+		return nil, err
+	}
+	originalMAC, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, key, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the MAC: %v", err)
+	}
+	if originalMAC != mac {
+		return nil, errors.New("MAC mismatch: the file is modified")
+	}
+
+	if format == formatDotenv {
+		return emitSOPSDotenv(tree.Branches)
+	}
+	return store.EmitPlainFile(tree.Branches)
+}
+
+// sopsMACOnlyEncrypted returns true if the metadata enables mac_only_encrypted.
+// SOPS v3.8 ignores it, and then fails to verify the MAC.
+func sopsMACOnlyEncrypted(format string, data []byte) bool {
+	if format == formatDotenv {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == "sops_mac_only_encrypted=true" {
+				return true
+			}
+		}
+		return false
+	}
+	// JSON is also parsed as YAML.
+	var tree struct {
+		SOPS struct {
+			MACOnlyEncrypted bool `yaml:"mac_only_encrypted"`
+		} `yaml:"sops"`
+	}
+	return yaml.Unmarshal(data, &tree) == nil && tree.SOPS.MACOnlyEncrypted
+}
+
+// emitSOPSDotenv emits the decrypted dotenv file. The values are quoted, so that parseDotenv restores the newlines,
+// the quotes and " #" as they are, while SOPS writes them as they are except the newlines.
+func emitSOPSDotenv(branches sops.TreeBranches) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, item := range branches[0] {
+		if comment, ok := item.Key.(sops.Comment); ok {
+			fmt.Fprintf(&buf, "#%s\n", comment.Value)
+			continue
+		}
+		value, ok := item.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid dotenv value of %v", item.Key)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", item.Key, quoteDotenv(value))
+	}
+	return buf.Bytes(), nil
+}
+
+// sopsKeyService is the in-process key service of SOPS, which decrypts the data keys with the configured keys.
+type sopsKeyService struct {
+	keys *sopsKeys
+}
+
+func (s *sopsKeyService) Encrypt(ctx context.Context, req *keyservice.EncryptRequest, opts ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	return nil, errors.New("encryption is not supported")
+}
+
+func (s *sopsKeyService) Decrypt(ctx context.Context, req *keyservice.DecryptRequest, opts ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	var plaintext []byte
+	var err error
+	switch k := req.GetKey().GetKeyType().(type) {
+	case *keyservice.Key_AgeKey:
+		// SOPS reads the identities from the environment when none is given.
+		if len(s.keys.age) == 0 {
+			return nil, errors.New("no age identities are configured")
+		}
+		key := &sopsage.MasterKey{Recipient: k.AgeKey.GetRecipient(), EncryptedKey: string(req.GetCiphertext())}
+		sopsage.ParsedIdentities(s.keys.age).ApplyToMasterKey(key)
+		plaintext, err = key.Decrypt()
+	case *keyservice.Key_PgpKey:
+		plaintext, err = decryptPGPDataKey(s.keys.pgp, req.GetCiphertext())
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+// decryptPGPDataKey decrypts the armored data key with the PGP private keys.
+func decryptPGPDataKey(keys openpgp.EntityList, ciphertext []byte) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no pgp keys are configured")
+	}
+	block, err := armor.Decode(bytes.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+	md, err := openpgp.ReadMessage(block.Body, keys, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(md.UnverifiedBody)
+}
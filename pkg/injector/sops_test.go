@@ -0,0 +1,114 @@
+package injector
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/keyservice"
+)
+
+// The files in testdata/sops are encrypted by sops 3.13.3 and age 1.2.1 with key.agekey and key.asc.
+// plain.* are the plaintexts of secrets.*, and mac-mismatch.yaml is secrets.yaml with a value removed.
+// mac-only-encrypted.yaml is rejected, since SOPS v3.8 used for the decryption does not know mac_only_encrypted.
+
+func TestSOPSDecrypt(t *testing.T) {
+	ageKey := filepath.Join("testdata", "sops", "key.agekey")
+	pgpKey := filepath.Join("testdata", "sops", "key.asc")
+	otherKey := filepath.Join("testdata", "sops", "other.agekey")
+
+	testCases := []struct {
+		name     string
+		ageKey   string
+		pgpKey   string
+		format   string
+		file     string
+		expected string
+		// values are the expected values when the plaintext is not parsed in the same way, e.g. dotenv.
+		values map[string]string
+		err    string
+	}{
+		{name: "yaml with age", ageKey: ageKey, format: formatYAML, file: "secrets.yaml", expected: "plain.yaml"},
+		{name: "yaml with pgp", pgpKey: pgpKey, format: formatYAML, file: "secrets.yaml", expected: "plain.yaml"},
+		{name: "json", ageKey: ageKey, format: formatJSON, file: "secrets.json", expected: "plain.json"},
+		{name: "dotenv", ageKey: ageKey, format: formatDotenv, file: "secrets.env", values: map[string]string{
+			// sops takes the values of dotenv files literally except for the escaped newlines.
+			"USER":     "admin",
+			"PASSWORD": "p@ss #word",
+			"QUOTED":   `"quoted"`,
+			"KEY":      "-----BEGIN KEY-----\nline1\nline2\n-----END KEY-----",
+		}},
+		{name: "mac only encrypted", ageKey: ageKey, format: formatYAML, file: "mac-only-encrypted.yaml", err: "mac_only_encrypted is not supported"},
+		{name: "mac mismatch", ageKey: ageKey, format: formatYAML, file: "mac-mismatch.yaml", err: "MAC mismatch"},
+		{name: "wrong key", ageKey: otherKey, format: formatYAML, file: "secrets.yaml", err: "none of the configured age or pgp keys"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := newSOPSDecryptor(nil, tc.ageKey, tc.pgpKey, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := readTestData(t, "sops", tc.file)
+			if !isSOPSFile(tc.format, data) {
+				t.Fatalf("%s is not detected as a sops file", tc.file)
+			}
+			plain, err := d.decrypt(context.Background(), tc.format, data)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := parseFile(tc.format, plain)
+			if err != nil {
+				t.Fatalf("could not parse the plaintext: %v\n%s", err, plain)
+			}
+			actualValues, err := stringValues(actual, nestedFlatten, defaultKeySeparator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedValues := tc.values
+			if expectedValues == nil {
+				expected, err := parseFile(tc.format, readTestData(t, "sops", tc.expected))
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectedValues, err = stringValues(expected, nestedFlatten, defaultKeySeparator)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(actualValues, expectedValues) {
+				t.Errorf("expected %v, got %v", expectedValues, actualValues)
+			}
+		})
+	}
+}
+
+func TestSOPSKeyServiceUnsupportedKeys(t *testing.T) {
+	s := &sopsKeyService{keys: &sopsKeys{}}
+	_, err := s.Decrypt(context.Background(), &keyservice.DecryptRequest{
+		Key:        &keyservice.Key{KeyType: &keyservice.Key_KmsKey{KmsKey: &keyservice.KmsKey{Arn: "arn:aws:kms:us-east-1:0:key/0"}}},
+		Ciphertext: []byte("ciphertext"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported key type") {
+		t.Errorf("expected the KMS key to be unsupported, got %v", err)
+	}
+
+	// The identities in the environment are never used.
+	t.Setenv(sopsage.SopsAgeKeyFileEnv, filepath.Join("testdata", "sops", "key.agekey"))
+	_, err = s.Decrypt(context.Background(), &keyservice.DecryptRequest{
+		Key:        &keyservice.Key{KeyType: &keyservice.Key_AgeKey{AgeKey: &keyservice.AgeKey{}}},
+		Ciphertext: []byte("ciphertext"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "no age identities") {
+		t.Errorf("expected no age identities, got %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package injector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v2"
+)
+
+// templateSuffixes are removed from the names of the template files to make the keys.
+var templateSuffixes = []string{".tmpl", ".tpl"}
+
+// renderTemplates renders the templates at opt.template against the values of src, and replaces the values
+// with the outputs keyed by the names of the templates. The templates are read from the same commit as src.
+func (in *Injector) renderTemplates(ctx context.Context, opt *option, src *source) error {
+	repo := in.repositories[opt.provider]
+	file, dir, err := repo.getContents(ctx, opt, src.rev.commit, opt.template)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{}
+	hash := map[string]string{}
+	paths := map[string]string{}
+	templates := dir
+	if file != nil {
+		templates = []*blob{file}
+	}
+	for _, t := range templates {
+		name := t.name
+		if file == nil {
+			name = dirKey(opt, opt.template, t)
+		}
+		for _, suffix := range templateSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				name = strings.TrimSuffix(name, suffix)
+				break
+			}
+		}
+		if name == "" {
+			return fmt.Errorf("invalid template name: %s", t.path)
+		}
+		if p, ok := paths[name]; ok {
+			return fmt.Errorf("both %s and %s are rendered into the key %s", p, t.path, name)
+		}
+		paths[name] = t.path
+
+		out, err := renderTemplate(t.path, t.data, src.data)
+		if err != nil {
+			return err
+		}
+		data[name] = out
+		hash[name] = t.sha
+	}
+
+	// The keys of the values are no longer in the data, so their hashes are not annotated.
+	src.data = data
+	src.templateHash = hash
+	src.dirHash = nil
+	for _, overlay := range src.overlays {
+		overlay.dirHash = nil
+	}
+	return nil
+}
+
+// renderTemplate renders the Go template against the values.
+// The template fails on a missing key, except where the key is passed to default or required,
+// or tested by if or with.
+func renderTemplate(name string, text []byte, values map[string]string) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			optionalKeys(t.Tree.Root)
+		}
+	}
+	data := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		data[k] = v
+	}
+	var b strings.Builder
+	err = tmpl.Execute(&b, data)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// optionalKeys rewrites the keys which may be missing, such as `.key` in `{{ .key | default "x" }}`,
+// into `(index . "key")`, which evaluates a missing key to nil instead of failing.
+func optionalKeys(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			optionalKeys(c)
+		}
+	case *parse.ActionNode:
+		optionalKeys(n.Pipe)
+	case *parse.TemplateNode:
+		optionalKeys(n.Pipe)
+	case *parse.IfNode:
+		optionalBranch(&n.BranchNode)
+	case *parse.WithNode:
+		optionalBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		optionalKeys(n.Pipe)
+		optionalKeys(n.List)
+		optionalKeys(n.ElseList)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for i, cmd := range n.Cmds {
+			// The value piped into default or required, such as `.key` in `{{ .key | default "x" }}`.
+			if i > 0 && isOptionalFunc(cmd) && len(n.Cmds[i-1].Args) == 1 {
+				n.Cmds[i-1].Args[0] = optionalKey(n.Cmds[i-1].Args[0])
+			}
+			optionalKeys(cmd)
+		}
+	case *parse.CommandNode:
+		for i, arg := range n.Args {
+			if i > 0 && isOptionalFunc(n) {
+				n.Args[i] = optionalKey(arg)
+			}
+			optionalKeys(n.Args[i])
+		}
+	}
+}
+
+// optionalBranch allows the missing keys tested by if or with, such as `{{ if .key }}`.
+func optionalBranch(n *parse.BranchNode) {
+	if len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
+		n.Pipe.Cmds[0].Args[0] = optionalKey(n.Pipe.Cmds[0].Args[0])
+	}
+	optionalKeys(n.Pipe)
+	optionalKeys(n.List)
+	optionalKeys(n.ElseList)
+}
+
+func isOptionalFunc(cmd *parse.CommandNode) bool {
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && (ident.Ident == "default" || ident.Ident == "required")
+}
+
+// optionalKey returns `(index . "key")` for `.key`, and `(index $ "key")` for `$.key`.
+// The other nodes are returned as they are.
+func optionalKey(node parse.Node) parse.Node {
+	var receiver parse.Node
+	var key string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		if len(n.Ident) != 1 {
+			return node
+		}
+		receiver = &parse.DotNode{NodeType: parse.NodeDot, Pos: n.Pos}
+		key = n.Ident[0]
+	case *parse.VariableNode:
+		if len(n.Ident) != 2 || n.Ident[0] != "$" {
+			return node
+		}
+		receiver = &parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: []string{"$"}}
+		key = n.Ident[1]
+	default:
+		return node
+	}
+	pos := node.Position()
+	return &parse.PipeNode{
+		NodeType: parse.NodePipe,
+		Pos:      pos,
+		Cmds: []*parse.CommandNode{{
+			NodeType: parse.NodeCommand,
+			Pos:      pos,
+			Args: []parse.Node{
+				parse.NewIdentifier("index").SetPos(pos),
+				receiver,
+				&parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(key), Text: key},
+			},
+		}},
+	}
+}
+
+// templateFuncs are the helper functions of the templates.
+// They follow the names and the argument orders of Sprig (https://masterminds.github.io/sprig/)
+// so that the pipelines like `{{ .password | b64enc }}` work as in Helm charts.
+var templateFuncs = template.FuncMap{
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"b64dec": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"toYaml": func(v interface{}) (string, error) {
+		b, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(b), "\n"), err
+	},
+	"indent": indent,
+	"nindent": func(n int, s string) string {
+		return "\n" + indent(n, s)
+	},
+	"quote": strconv.Quote,
+	"squote": func(s string) string {
+		return "'" + s + "'"
+	},
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       join,
+	"sha256sum": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"default": func(def, v interface{}) interface{} {
+		if isEmptyValue(v) {
+			return def
+		}
+		return v
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if isEmptyValue(v) {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	},
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+func join(sep string, list interface{}) (string, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: %T is not a list", list)
+	}
+	elems := make([]string, v.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(elems, sep), nil
+}
+
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
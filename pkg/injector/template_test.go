@@ -0,0 +1,93 @@
+package injector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	values := map[string]string{
+		"user":     "admin",
+		"password": "p@ss",
+		"empty":    "",
+	}
+	testCases := []struct {
+		name     string
+		text     string
+		expected string
+		err      string
+	}{
+		{name: "values", text: "{{ .user }}:{{ .password }}", expected: "admin:p@ss"},
+		{name: "pipeline", text: "{{ .user | b64enc }}", expected: "YWRtaW4="},
+		{name: "root variable", text: "{{ range splitList \",\" \"a,b\" }}{{ . }}{{ $.user }}{{ end }}", expected: "aadminbadmin"},
+		{name: "missing key", text: "{{ .missing }}", err: "missing"},
+		{name: "missing key in a function", text: "{{ .missing | b64enc }}", err: "missing"},
+		{name: "missing root variable", text: "{{ $.missing }}", err: "missing"},
+		{name: "missing key in a defined template", text: "{{ define \"x\" }}{{ .missing }}{{ end }}{{ template \"x\" . }}", err: "missing"},
+		// The output of "<no value>" is not confused with a missing key.
+		{name: "no value", text: "{{ \"<no value>\" }}", expected: "<no value>"},
+		{name: "default of a missing key", text: "{{ .missing | default \"x\" }}", expected: "x"},
+		{name: "default of an empty key", text: "{{ .empty | default \"x\" }}", expected: "x"},
+		{name: "default of a key", text: "{{ .user | default \"x\" }}", expected: "admin"},
+		{name: "default as a function", text: "{{ default \"x\" .missing }}", expected: "x"},
+		{name: "default of a root variable", text: "{{ $.missing | default \"x\" }}", expected: "x"},
+		{name: "default in a defined template", text: "{{ define \"x\" }}{{ .missing | default \"x\" }}{{ end }}{{ template \"x\" . }}", expected: "x"},
+		{name: "required of a key", text: "{{ required \"need user\" .user }}", expected: "admin"},
+		{name: "required of a missing key", text: "{{ .missing | required \"need missing\" }}", err: "need missing"},
+		{name: "if of a missing key", text: "{{ if .missing }}yes{{ else }}no{{ end }}", expected: "no"},
+		{name: "with of a missing key", text: "{{ with .missing }}{{ . }}{{ else }}none{{ end }}", expected: "none"},
+		{name: "with of a key", text: "{{ with .user }}{{ . }}{{ end }}", expected: "admin"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := renderTemplate("test", []byte(tc.text), values)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected the error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, out)
+			}
+		})
+	}
+}
+
+func TestRenderTemplatesAnnotations(t *testing.T) {
+	in := newTestInjector(map[string]string{
+		"values/user":     "admin",
+		"values/password": "pass",
+		"dsn.tmpl":        "{{ .user }}:{{ .password }}@db",
+	})
+	opt := &option{provider: providerGitHub, owner: "owner", repo: "repo", repository: "owner/repo", source: "values", template: "dsn.tmpl"}
+	src, err := in.fetch(context.Background(), opt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := &corev1.Secret{}
+	err = in.applySource(sec, src, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(sec.Data, map[string][]byte{"dsn": []byte("admin:pass@db")}) {
+		t.Errorf("unexpected data: %v", sec.Data)
+	}
+	// The keys of the values are not in the data, so their hashes are not annotated.
+	expected := map[string]string{
+		SourceCommitKey:               githubTestCommit,
+		SourceRefKey:                  "refs/heads/main",
+		TemplateHashKeyPrefix + "dsn": "blob-dsn.tmpl",
+	}
+	if !reflect.DeepEqual(sec.Annotations, expected) {
+		t.Errorf("expected %v, got %v", expected, sec.Annotations)
+	}
+}
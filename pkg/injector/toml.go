@@ -0,0 +1,52 @@
+package injector
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML parses the TOML document (https://toml.io/en/v1.0.0).
+// The tables are decoded into map[string]interface{}, the arrays into []interface{},
+// the integers into int64, the floats into float64, and the date-times into the strings in RFC 3339.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	_, err := toml.Decode(string(data), &values)
+	if err != nil {
+		// The errors of the parser are prefixed with "toml:".
+		return nil, err
+	}
+	return tomlDateTimes(values).(map[string]interface{}), nil
+}
+
+// tomlDateTimes replaces the date-times in v with the strings.
+// The local date-times, dates and times are decoded into time.Time in the special locations.
+func tomlDateTimes(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = tomlDateTimes(item)
+		}
+	case []map[string]interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, tomlDateTimes(item))
+		}
+		return list
+	case []interface{}:
+		for i, item := range v {
+			v[i] = tomlDateTimes(item)
+		}
+	case time.Time:
+		switch v.Location().String() {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		case "date-local":
+			return v.Format("2006-01-02")
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return v
+}
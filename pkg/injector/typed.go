@@ -0,0 +1,182 @@
+package injector
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The keys to build .dockerconfigjson of kubernetes.io/dockerconfigjson Secrets.
+const (
+	dockerRegistryKey = "registry"
+	dockerUsernameKey = "username"
+	dockerPasswordKey = "password"
+	dockerEmailKey    = "email"
+)
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// shapeTypedSecret validates the data of the built-in Secret types, so that the injected Secrets are usable.
+// .dockerconfigjson is built from the registry, username, password and email entries if they are in the data.
+// It returns deniedError describing why the data does not fit the type.
+func shapeTypedSecret(sec *corev1.Secret) error {
+	var err error
+	switch sec.Type {
+	case corev1.SecretTypeTLS:
+		err = validateTLSSecret(sec.Data)
+	case corev1.SecretTypeDockerConfigJson:
+		err = shapeDockerConfigJSONSecret(sec)
+	case corev1.SecretTypeBasicAuth:
+		err = validateBasicAuthSecret(sec.Data)
+	case corev1.SecretTypeSSHAuth:
+		err = validateSSHAuthSecret(sec.Data)
+	}
+	if err != nil {
+		return &deniedError{reason: fmt.Sprintf("invalid %s Secret: %v", sec.Type, err)}
+	}
+	return nil
+}
+
+func validateTLSSecret(data map[string][]byte) error {
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey} {
+		if len(data[key]) == 0 {
+			return fmt.Errorf("%s is missing", key)
+		}
+	}
+	// X509KeyPair also checks that the private key matches the public key of the certificate.
+	_, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Errorf("%s and %s are not a valid pair: %v", corev1.TLSCertKey, corev1.TLSPrivateKeyKey, err)
+	}
+	return nil
+}
+
+func shapeDockerConfigJSONSecret(sec *corev1.Secret) error {
+	data := sec.Data
+	_, hasRegistry := data[dockerRegistryKey]
+	_, hasUsername := data[dockerUsernameKey]
+	_, hasPassword := data[dockerPasswordKey]
+	if v, ok := data[corev1.DockerConfigJsonKey]; ok && !hasRegistry && !hasUsername && !hasPassword {
+		var config dockerConfigJSON
+		err := json.Unmarshal(v, &config)
+		if err != nil {
+			return fmt.Errorf("%s is not valid JSON: %v", corev1.DockerConfigJsonKey, err)
+		}
+		if config.Auths == nil {
+			return fmt.Errorf("%s has no auths", corev1.DockerConfigJsonKey)
+		}
+		return nil
+	}
+
+	registry := string(data[dockerRegistryKey])
+	username := string(data[dockerUsernameKey])
+	password := string(data[dockerPasswordKey])
+	if registry == "" || username == "" || password == "" {
+		return fmt.Errorf("either %s or all of %s, %s and %s are required",
+			corev1.DockerConfigJsonKey, dockerRegistryKey, dockerUsernameKey, dockerPasswordKey)
+	}
+	config := dockerConfigJSON{
+		Auths: map[string]dockerConfigEntry{
+			registry: {
+				Username: username,
+				Password: password,
+				Email:    string(data[dockerEmailKey]),
+				Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+			},
+		},
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	// The entries are consumed, so that the credentials are stored only in .dockerconfigjson.
+	keys := []string{dockerRegistryKey, dockerUsernameKey, dockerPasswordKey, dockerEmailKey}
+	for _, key := range keys {
+		delete(data, key)
+	}
+	data[corev1.DockerConfigJsonKey] = b
+
+	// The hashes of the consumed entries are replaced with the hash of .dockerconfigjson,
+	// so that the changes of the entries are still detected.
+	hash := consumeHashAnnotations(sec.Annotations, keys)
+	if hash != "" {
+		sec.Annotations[SourceHashKeyPrefix+corev1.DockerConfigJsonKey] = hash
+	}
+	return nil
+}
+
+// consumeHashAnnotations removes the hash annotations of the keys, including those of the additional sources and
+// the templates. It returns the SHA-256 of the removed annotations, or an empty string if none is removed.
+func consumeHashAnnotations(annotations map[string]string, keys []string) string {
+	var removed []string
+	for k, v := range annotations {
+		for _, key := range keys {
+			if !isHashAnnotationOf(k, key) {
+				continue
+			}
+			removed = append(removed, k+"="+v+"\n")
+			delete(annotations, k)
+			break
+		}
+	}
+	if len(removed) == 0 {
+		return ""
+	}
+	sort.Strings(removed)
+	sum := sha256.Sum256([]byte(strings.Join(removed, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// isHashAnnotationOf returns true if k is the hash annotation of key, e.g. "hash_key", "hash-1_key" or
+// "template-hash_key".
+func isHashAnnotationOf(k, key string) bool {
+	if k == SourceHashKeyPrefix+key || k == TemplateHashKeyPrefix+key {
+		return true
+	}
+	if !strings.HasPrefix(k, SourceHashKey+"-") {
+		return false
+	}
+	// The indices of the additional sources never contain "_".
+	rest := strings.TrimPrefix(k, SourceHashKey+"-")
+	i := strings.Index(rest, "_")
+	return i >= 0 && rest[i+1:] == key
+}
+
+func validateBasicAuthSecret(data map[string][]byte) error {
+	_, hasUsername := data[corev1.BasicAuthUsernameKey]
+	_, hasPassword := data[corev1.BasicAuthPasswordKey]
+	if !hasUsername && !hasPassword {
+		return fmt.Errorf("either %s or %s is required", corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey)
+	}
+	return nil
+}
+
+func validateSSHAuthSecret(data map[string][]byte) error {
+	key, ok := data[corev1.SSHAuthPrivateKey]
+	if !ok {
+		return fmt.Errorf("%s is missing", corev1.SSHAuthPrivateKey)
+	}
+	_, err := ssh.ParseRawPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid private key: %v", corev1.SSHAuthPrivateKey, err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package injector
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestShapeDockerConfigJSONSecretAnnotations(t *testing.T) {
+	newSecret := func(usernameHash string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					SourceHashKeyPrefix + "registry":    "1",
+					SourceHashKeyPrefix + "username":    usernameHash,
+					TemplateHashKeyPrefix + "password":  "3",
+					SourceHashKey + "-1_email":          "4",
+					SourceHashKeyPrefix + "other":       "5",
+					SourceHashKey + "-1_my_registry":    "6",
+					SourceCommitKey:                     githubTestCommit,
+					SourceHashKeyPrefix + "registry.md": "7",
+				},
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				"registry":    []byte("registry.example.com"),
+				"username":    []byte("user"),
+				"password":    []byte("pass"),
+				"email":       []byte("user@example.com"),
+				"other":       []byte("other"),
+				"my_registry": []byte("other"),
+				"registry.md": []byte("other"),
+			},
+		}
+	}
+
+	sec := newSecret("2")
+	err := shapeTypedSecret(sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sec.Annotations[SourceHashKeyPrefix+corev1.DockerConfigJsonKey]
+	if hash == "" {
+		t.Fatal("expected the hash of .dockerconfigjson")
+	}
+	expected := map[string]string{
+		SourceHashKeyPrefix + "other":                    "5",
+		SourceHashKey + "-1_my_registry":                 "6",
+		SourceCommitKey:                                  githubTestCommit,
+		SourceHashKeyPrefix + "registry.md":              "7",
+		SourceHashKeyPrefix + corev1.DockerConfigJsonKey: hash,
+	}
+	if !reflect.DeepEqual(sec.Annotations, expected) {
+		t.Errorf("expected %v, got %v", expected, sec.Annotations)
+	}
+
+	// The change of a consumed entry changes the hash of .dockerconfigjson.
+	changed := newSecret("changed")
+	err = shapeTypedSecret(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Annotations[SourceHashKeyPrefix+corev1.DockerConfigJsonKey] == hash {
+		t.Error("expected the hash of .dockerconfigjson to change")
+	}
+
+	// The Secrets from a single file have no hash annotations of the entries.
+	file := newSecret("2")
+	file.Annotations = map[string]string{SourceHashKey: "1"}
+	err = shapeTypedSecret(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file.Annotations, map[string]string{SourceHashKey: "1"}) {
+		t.Errorf("expected only the hash of the file, got %v", file.Annotations)
+	}
+}
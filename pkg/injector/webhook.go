@@ -2,32 +2,152 @@ package injector
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"path"
 	"strings"
 
 	"github.com/go-logr/logr"
-	"github.com/google/go-github/v30/github"
-	"golang.org/x/oauth2"
-	"gopkg.in/yaml.v2"
+	injectorv1alpha1 "github.com/masa213f/secret-injector/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
 )
 
 // Injector is mutateing webhook and controller.
 type Injector struct {
 	decoder      *admission.Decoder
-	githubClient *github.Client
-	log          logr.Logger
+	repositories map[string]repository
+	policy       *policyChecker
+	// verifier verifies the signatures of the commits. It is nil when the verification is disabled.
+	verifier *signatureVerifier
+	// sops decrypts the SOPS files and the age files. It is nil when no keys are configured.
+	sops *sopsDecryptor
+	// requirePinned requires the sources to be pinned to commits.
+	requirePinned bool
+	// maxSize is the maximum size of the data of a Secret and of each file in the sources.
+	maxSize int
+	log     logr.Logger
 }
 
+// Config is the configuration of the Injector.
+type Config struct {
+	// Client is used to read the Kubernetes resources.
+	Client client.Reader
+
+	GitHubToken     string
+	GitHubBaseURL   string
+	GitHubUploadURL string
+	GitHubCAFile    string
+
+	// The token is read from the file or the Secret ("namespace/name") instead of GitHubToken when they are set.
+	GitHubTokenFile      string
+	GitHubTokenSecret    string
+	GitHubTokenSecretKey string
+
+	// GitHubCredentialMap is the ConfigMap ("namespace/name") which maps the namespaces and the repositories to the tokens.
+	GitHubCredentialMap string
+
+	// GitHub App authentication is used instead of GitHubToken when GitHubAppIDFile is set.
+	GitHubAppIDFile             string
+	GitHubAppInstallationIDFile string
+	GitHubAppPrivateKeyFile     string
+
+	// Policy is the ConfigMap ("namespace/name") which declares the sources each namespace may reference.
+	// All sources are allowed when it is empty.
+	Policy string
+
+	GitLabURL   string
+	GitLabToken string
+	GitCacheDir string
+
+	// The key and the known_hosts file for the SSH URLs of the git provider.
+	// The host keys are always verified, so the SSH URLs fail when GitSSHKnownHostsFile is empty.
+	GitSSHKeyFile        string
+	GitSSHKnownHostsFile string
+
+	// RequirePinned rejects the sources which are not pinned to a full commit SHA.
+	RequirePinned bool
+
+	// The commits or the annotated tags are required to be signed by the keys in the GPG keyring
+	// or the SSH allowed signers file when either of them is set.
+	SignatureGPGKeyring        string
+	SignatureSSHAllowedSigners string
+
+	// The keys to decrypt the SOPS files and the age files. SOPSKeySecret is the Secret ("namespace/name")
+	// holding the age identities in "*.agekey" and the armored PGP private keys in "*.asc".
+	SOPSAgeKeyFile string
+	SOPSPGPKeyFile string
+	SOPSKeySecret  string
+
+	// MaxSecretSize is the maximum size of the data of a Secret and of each file in the sources.
+	// It defaults to and cannot exceed 1 MiB, the limit of Kubernetes.
+	MaxSecretSize int
+}
+
+// maxSecretSize is the maximum size of the data of a Secret in Kubernetes.
+const maxSecretSize = 1024 * 1024
+
 type option struct {
-	owner  string
-	repo   string
-	branch string
-	source string
-	prune  bool
+	namespace  string
+	provider   string
+	repository string
+	owner      string
+	repo       string
+	branch     string
+	tag        string
+	commit     string
+	source     string
+	// format is the format of the file source. It is detected by the extension when it is empty.
+	format string
+	// nested and separator specify how the nested values in the file source are stored.
+	nested    string
+	separator string
+	// selectPath is the path expression which selects the map in the file source.
+	selectPath string
+	// include, exclude, keyPrefix, keySuffix and rename (from the new keys to the old keys) map the keys of the source.
+	include   []string
+	exclude   []string
+	keyPrefix string
+	keySuffix string
+	rename    map[string]string
+	// recursive reads the files in the subdirectories of the directory source.
+	recursive bool
+	// template is the path of the template file or directory rendered against the values of the source.
+	template string
+	// sources are the additional sources merged in order, and conflict specifies how the duplicate keys are handled.
+	sources  []*option
+	conflict string
+	prune    bool
+}
+
+// ref returns the fully qualified name of the branch or the tag.
+// It returns an empty string for the default branch or a commit.
+func (o *option) ref() string {
+	switch {
+	case strings.HasPrefix(o.branch, "refs/"):
+		return o.branch
+	case o.branch != "":
+		return "refs/heads/" + o.branch
+	case o.tag != "":
+		return "refs/tags/" + o.tag
+	}
+	return ""
+}
+
+// deniedError is an error which denies the admission request rather than failing it.
+type deniedError struct {
+	reason string
+}
+
+func (e *deniedError) Error() string {
+	return e.reason
 }
 
 const (
@@ -37,74 +157,337 @@ const (
 
 type source struct {
 	srcType  int
+	rev      *revision
 	fileHash string
 	dirHash  map[string]string
-	data     map[string]string
+	// templateHash is the SHAs of the templates keyed by the rendered keys.
+	templateHash map[string]string
+	data         map[string]string
+	// overlays are the additional sources merged into data. Only their revisions and hashes are used.
+	overlays []*source
 }
 
 // New creates the new Injector.
-func New(githubToken string, log logr.Logger) admission.Handler {
-	var c *http.Client
-	if githubToken != "" {
-		ctx := context.Background()
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: githubToken},
-		)
-		c = oauth2.NewClient(ctx, ts)
+func New(cfg Config, log logr.Logger) (*Injector, error) {
+	maxSize := cfg.MaxSecretSize
+	if maxSize == 0 {
+		maxSize = maxSecretSize
+	}
+	if maxSize < 0 || maxSize > maxSecretSize {
+		return nil, fmt.Errorf("the maximum size of Secrets must be between 1 and %d bytes: %d", maxSecretSize, maxSize)
+	}
+	c, err := newHTTPClient(cfg.GitHubCAFile)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := newGitHubClientFactory(c, cfg.GitHubBaseURL, cfg.GitHubUploadURL)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := newGitHubCredential(cfg, clients)
+	if err != nil {
+		return nil, err
+	}
+	gitlab, err := newGitLabRepository(nil, cfg.GitLabURL, cfg.GitLabToken)
+	if err != nil {
+		return nil, err
+	}
+	var policy *policyChecker
+	if cfg.Policy != "" {
+		name, err := parseNamespacedName(cfg.Policy)
+		if err != nil {
+			return nil, err
+		}
+		policy = newPolicyChecker(cfg.Client, name)
+	}
+	var verifier *signatureVerifier
+	if cfg.SignatureGPGKeyring != "" || cfg.SignatureSSHAllowedSigners != "" {
+		verifier, err = newSignatureVerifier(cfg.SignatureGPGKeyring, cfg.SignatureSSHAllowedSigners)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var sops *sopsDecryptor
+	if cfg.SOPSAgeKeyFile != "" || cfg.SOPSPGPKeyFile != "" || cfg.SOPSKeySecret != "" {
+		sops, err = newSOPSDecryptor(cfg.Client, cfg.SOPSAgeKeyFile, cfg.SOPSPGPKeyFile, cfg.SOPSKeySecret)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &Injector{
-		githubClient: github.NewClient(c),
-		log:          log.WithName("webhook"),
+		repositories: map[string]repository{
+			providerGitHub: newGitHubRepository(clients, credential, maxSize),
+			providerGitLab: gitlab,
+			providerGit:    newGitRepository(cfg.GitCacheDir, cfg.GitSSHKeyFile, cfg.GitSSHKnownHostsFile),
+		},
+		policy:        policy,
+		verifier:      verifier,
+		sops:          sops,
+		requirePinned: cfg.RequirePinned,
+		maxSize:       maxSize,
+		log:           log.WithName("webhook"),
+	}, nil
+}
+
+func newGitHubCredential(cfg Config, clients *githubClientFactory) (githubCredential, error) {
+	switch {
+	case cfg.GitHubCredentialMap != "":
+		name, err := parseNamespacedName(cfg.GitHubCredentialMap)
+		if err != nil {
+			return nil, err
+		}
+		return newMappedGitHubCredential(cfg.Client, name), nil
+	case cfg.GitHubAppIDFile != "":
+		return newGitHubAppCredentialFromFiles(clients,
+			cfg.GitHubAppIDFile, cfg.GitHubAppInstallationIDFile, cfg.GitHubAppPrivateKeyFile)
+	case cfg.GitHubTokenSecret != "":
+		name, err := parseNamespacedName(cfg.GitHubTokenSecret)
+		if err != nil {
+			return nil, err
+		}
+		key := cfg.GitHubTokenSecretKey
+		if key == "" {
+			key = "token"
+		}
+		return newSecretGitHubCredential(cfg.Client, name, key), nil
+	case cfg.GitHubTokenFile != "":
+		return newFileGitHubCredential(cfg.GitHubTokenFile)
 	}
+	return newStaticGitHubCredential(cfg.GitHubToken), nil
+}
+
+// newHTTPClient creates a HTTP client which trusts the CA certificates in caFile in addition to the system ones.
+func newHTTPClient(caFile string) (*http.Client, error) {
+	if caFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no valid certificate in " + caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+// InjectDecoder injects the decoder.
+func (in *Injector) InjectDecoder(d *admission.Decoder) error {
+	in.decoder = d
+	return nil
 }
 
 func (in *Injector) decodeAnnotations(sec *corev1.Secret) (*option, error) {
-	val, exist := sec.Annotations[RepoNameKey]
+	repository, exist := sec.Annotations[RepoNameKey]
 	if !exist {
 		return nil, errors.New("no annotation: " + RepoNameKey)
 	}
-	ownerRepo := strings.Split(val, "/")
-	if len(ownerRepo) != 2 || ownerRepo[0] == "" || ownerRepo[1] == "" {
-		return nil, errors.New("invalid annotation: " + RepoNameKey)
-	}
 	source, exist := sec.Annotations[SourcePathKey]
 	if !exist {
 		return nil, errors.New("no annotation: " + SourcePathKey)
 	}
-	branch := sec.Annotations[BranchNameKey]
-	prune := sec.Annotations[PruneFlagKey]
 
-	opt := option{
-		owner:  ownerRepo[0],
-		repo:   ownerRepo[1],
-		branch: branch,
-		source: source,
-		prune:  prune == "true",
+	opt := &option{
+		provider:   sec.Annotations[ProviderKey],
+		repository: repository,
+		branch:     sec.Annotations[BranchNameKey],
+		tag:        sec.Annotations[TagNameKey],
+		commit:     sec.Annotations[CommitKey],
+		source:     source,
+		format:     sec.Annotations[FormatKey],
+		nested:     sec.Annotations[NestedValueKey],
+		separator:  sec.Annotations[KeySeparatorKey],
+		selectPath: sec.Annotations[SelectPathKey],
+		include:    splitList(sec.Annotations[IncludeKey]),
+		exclude:    splitList(sec.Annotations[ExcludeKey]),
+		keyPrefix:  sec.Annotations[KeyPrefixKey],
+		keySuffix:  sec.Annotations[KeySuffixKey],
+		recursive:  sec.Annotations[RecursiveFlagKey] == "true",
+		template:   sec.Annotations[TemplateKey],
+		conflict:   sec.Annotations[ConflictKey],
+		prune:      sec.Annotations[PruneFlagKey] == "true",
 	}
-	return &opt, nil
+	rename, err := parseRenames(sec.Annotations[RenameKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotations: %v", err)
+	}
+	opt.rename = rename
+	if v := sec.Annotations[SourcesKey]; v != "" {
+		var refs []injectorv1alpha1.SourceRef
+		err = yaml.UnmarshalStrict([]byte(v), &refs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotations: %s: %v", SourcesKey, err)
+		}
+		for i := range refs {
+			opt.sources = append(opt.sources, sourceRefOption(&refs[i]))
+		}
+	}
+	err = in.validateOption(opt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotations: %v", err)
+	}
+	return opt, nil
 }
 
-func (in *Injector) fetchSource(owner, repo, path, branch string) (*source, error) {
-	fileContent, dirContent, _, err := in.githubClient.Repositories.GetContents(
-		context.Background(), owner, repo, path, &github.RepositoryContentGetOptions{Ref: branch})
+// validateOption validates the specification of the source, and fills the derived fields of opt.
+// At most one of branch, tag and commit can be specified. The default branch is used when none of them is specified.
+func (in *Injector) validateOption(opt *option) error {
+	if opt.provider == "" {
+		opt.provider = providerGitHub
+	}
+	if _, ok := in.repositories[opt.provider]; !ok {
+		return errors.New("unknown provider: " + opt.provider)
+	}
+
+	var owner, repo string
+	switch opt.provider {
+	case providerGit:
+		// The repository is an arbitrary Git URL.
+		if opt.repository == "" {
+			return errors.New("empty repository")
+		}
+	case providerGitLab:
+		// GitLab allows nested groups (e.g. group/subgroup/project).
+		if i := strings.LastIndex(opt.repository, "/"); i >= 0 {
+			owner, repo = opt.repository[:i], opt.repository[i+1:]
+		}
+	default:
+		if ownerRepo := strings.Split(opt.repository, "/"); len(ownerRepo) == 2 {
+			owner, repo = ownerRepo[0], ownerRepo[1]
+		}
+	}
+	if opt.provider != providerGit && (owner == "" || repo == "") {
+		return errors.New("invalid repository: " + opt.repository)
+	}
+	opt.owner, opt.repo = owner, repo
+
+	// A full SHA in the branch has been accepted as a commit.
+	if isFullSHA(opt.branch) && opt.tag == "" && opt.commit == "" {
+		opt.branch, opt.commit = "", opt.branch
+	}
+	n := 0
+	for _, v := range []string{opt.branch, opt.tag, opt.commit} {
+		if v != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one of branch, tag and commit can be specified")
+	}
+	if opt.commit != "" && !isFullSHA(opt.commit) {
+		return errors.New("commit must be a full SHA: " + opt.commit)
+	}
+	if in.requirePinned && opt.commit == "" {
+		return errors.New("the source must be pinned to a commit")
+	}
+
+	if opt.format != "" && !containsString(formats, opt.format) {
+		return errors.New("unknown format: " + opt.format)
+	}
+	if opt.nested != "" && !containsString(nestedModes, opt.nested) {
+		return errors.New("unknown representation of nested values: " + opt.nested)
+	}
+	if _, err := parseSelectPath(opt.selectPath); err != nil {
+		return err
+	}
+	if opt.separator == "" {
+		opt.separator = defaultKeySeparator
+	}
+	if !secretKeyRegexp.MatchString(opt.separator) {
+		return errors.New("invalid key separator: " + opt.separator)
+	}
+	err := validateKeyMapping(opt)
+	if err != nil {
+		return err
+	}
+
+	if opt.conflict != "" && opt.conflict != conflictOverride && opt.conflict != conflictError {
+		return errors.New("unknown conflict mode: " + opt.conflict)
+	}
+	for _, sub := range opt.sources {
+		// The keys of all sources are made in the same way.
+		sub.nested, sub.separator, sub.recursive = opt.nested, opt.separator, opt.recursive
+		err := in.validateOption(sub)
+		if err != nil {
+			return fmt.Errorf("invalid source %s: %v", sourceName(sub), err)
+		}
+	}
+
+	// Normalize the paths so that the policy is checked against the paths actually read.
+	opt.source = strings.Trim(path.Clean("/"+opt.source), "/")
+	if opt.template != "" {
+		opt.template = strings.Trim(path.Clean("/"+opt.template), "/")
+	}
+	return nil
+}
+
+func (in *Injector) fetchSource(ctx context.Context, opt *option) (*source, error) {
+	repo := in.repositories[opt.provider]
+	// Resolve the ref first so that all files are read from the same commit.
+	rev, err := repo.resolve(ctx, opt)
 	if err != nil {
 		return nil, err
 	}
+	if in.verifier != nil {
+		err = in.verifyRevision(ctx, opt, rev)
+		if err != nil {
+			return nil, err
+		}
+	}
+	file, dir, err := repo.getContents(ctx, opt, rev.commit, opt.source)
+	if err != nil {
+		return nil, err
+	}
+	files := dir
+	if file != nil {
+		files = []*blob{file}
+	}
+	err = in.resolveLFS(ctx, opt, files)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if len(f.data) > in.maxSize {
+			return nil, fmt.Errorf("%s is %d bytes, which exceeds the maximum size %d bytes", f.path, len(f.data), in.maxSize)
+		}
+	}
 
-	if fileContent != nil {
-		raw, err := fileContent.GetContent()
+	if file != nil {
+		format := opt.format
+		if format == "" {
+			format = detectFormat(file.name)
+		}
+		err = in.decrypt(ctx, file, format)
+		if err != nil {
+			return nil, err
+		}
+		values, err := parseFile(format, file.data)
 		if err != nil {
 			return nil, err
 		}
-		data := map[string]string{}
-		err = yaml.Unmarshal([]byte(raw), &data)
+		if opt.selectPath != "" {
+			values, err = selectValues(values, opt.selectPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to select %s in %s: %v", opt.selectPath, opt.source, err)
+			}
+		}
+		data, err := stringValues(values, opt.nested, opt.separator)
 		if err != nil {
 			return nil, err
 		}
 
 		ret := source{
 			srcType:  typeFile,
-			fileHash: fileContent.GetSHA(),
+			rev:      rev,
+			fileHash: file.sha,
 			data:     data,
 		}
 		return &ret, nil
@@ -112,82 +495,255 @@ func (in *Injector) fetchSource(owner, repo, path, branch string) (*source, erro
 
 	hash := map[string]string{}
 	data := map[string]string{}
-	for _, fileMeta := range dirContent {
-		if !(fileMeta.Type == nil || *fileMeta.Type == "file") {
-			continue
+	paths := map[string]string{}
+	for _, file := range dir {
+		// The age files are stored under the names without the extension.
+		name := dirKey(opt, opt.source, file)
+		if strings.HasSuffix(name, ageFileSuffix) {
+			name = strings.TrimSuffix(name, ageFileSuffix)
+			err = in.decryptAge(ctx, file)
+		} else {
+			err = in.decrypt(ctx, file, detectFormat(file.name))
 		}
-
-		fileData, _, _, err := in.githubClient.Repositories.GetContents(
-			context.Background(), owner, repo, fileMeta.GetPath(), &github.RepositoryContentGetOptions{Ref: branch})
 		if err != nil {
 			return nil, err
 		}
-		str, err := fileData.GetContent()
-		if err != nil {
-			return nil, err
+		if name == "" {
+			return nil, fmt.Errorf("invalid file name: %s", file.path)
+		}
+		if p, ok := paths[name]; ok {
+			return nil, fmt.Errorf("both %s and %s are stored in the key %s", p, file.path, name)
 		}
-		hash[fileMeta.GetName()] = fileMeta.GetSHA()
-		data[fileMeta.GetName()] = str
+		paths[name] = file.path
+		hash[name] = file.sha
+		data[name] = string(file.data)
 	}
 
 	ret := source{
 		srcType: typeDir,
+		rev:     rev,
 		dirHash: hash,
 		data:    data,
 	}
 	return &ret, nil
 }
 
-// Handle handles addmission requests.
-func (in *Injector) Handle(ctx context.Context, req admission.Request) admission.Response {
-	sec := &corev1.Secret{}
-	err := in.decoder.Decode(req, sec)
+// sourceRefOption creates the option of the additional source.
+func sourceRefOption(ref *injectorv1alpha1.SourceRef) *option {
+	return &option{
+		provider:   ref.Provider,
+		repository: ref.Repository,
+		branch:     ref.Ref,
+		tag:        ref.Tag,
+		commit:     ref.Commit,
+		source:     ref.Path,
+		format:     ref.Format,
+		selectPath: ref.Select,
+	}
+}
+
+// sourceName returns the name of the source in the messages, e.g. "org/repo:path/to/file.yaml".
+func sourceName(opt *option) string {
+	return opt.repository + ":" + opt.source
+}
+
+// dirKey returns the key of the file in the directory dir.
+// The files in the subdirectories are keyed by the relative paths joined with the key separator, e.g. "a.b.txt" for "a/b.txt".
+func dirKey(opt *option, dir string, file *blob) string {
+	if !opt.recursive {
+		return file.name
+	}
+	rel := file.path
+	if dir != "" {
+		rel = strings.TrimPrefix(rel, dir+"/")
+	}
+	return strings.Replace(rel, "/", opt.separator, -1)
+}
+
+// decrypt replaces the data of the file in the format with the plaintext if it is encrypted by SOPS.
+func (in *Injector) decrypt(ctx context.Context, file *blob, format string) error {
+	if !isSOPSFile(format, file.data) {
+		return nil
+	}
+	if in.sops == nil {
+		return fmt.Errorf("%s is encrypted with sops, but no decryption keys are configured", file.path)
+	}
+	data, err := in.sops.decrypt(ctx, format, file.data)
 	if err != nil {
-		return admission.Errored(http.StatusBadRequest, err)
+		return fmt.Errorf("could not decrypt %s with sops: %v", file.path, err)
 	}
+	file.data = data
+	return nil
+}
 
-	if sec.Labels[WebhookTargetKey] != "true" {
-		return admission.Allowed("ok")
+// decryptAge replaces the data of the age file with the plaintext.
+func (in *Injector) decryptAge(ctx context.Context, file *blob) error {
+	if in.sops == nil {
+		return fmt.Errorf("%s is encrypted with age, but no age identities are configured", file.path)
+	}
+	data, err := in.sops.decryptAge(ctx, file.data)
+	if err != nil {
+		return fmt.Errorf("could not decrypt %s with age: %v", file.path, err)
 	}
+	file.data = data
+	return nil
+}
 
-	in.log.Info("Mutating Secrets", "namespace", req.Namespace, "name", req.Name)
+// fetch fetches the sources specified by opt, and maps the keys and renders the templates.
+// The namespace policy is checked against all sources when checkPolicy is true.
+func (in *Injector) fetch(ctx context.Context, opt *option, checkPolicy bool) (*source, error) {
+	src, err := in.fetchOne(ctx, opt, checkPolicy)
+	if err != nil {
+		return nil, err
+	}
 
-	opt, err := in.decodeAnnotations(sec)
+	// Merge the additional sources. The later sources take precedence.
+	if len(opt.sources) > 0 {
+		origins := make(map[string]string, len(src.data))
+		for k := range src.data {
+			origins[k] = sourceName(opt)
+		}
+		for _, sub := range opt.sources {
+			sub.namespace = opt.namespace
+			overlay, err := in.fetchOne(ctx, sub, checkPolicy)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range overlay.data {
+				if origin, ok := origins[k]; ok && opt.conflict == conflictError {
+					return nil, fmt.Errorf("key %s is defined in both %s and %s", k, origin, sourceName(sub))
+				}
+				origins[k] = sourceName(sub)
+				src.data[k] = v
+			}
+			src.overlays = append(src.overlays, overlay)
+		}
+	}
+
+	err = mapKeys(src, opt)
 	if err != nil {
-		in.log.Error(err, "Could not decode annotations")
-		return admission.Errored(http.StatusBadRequest, err)
+		return nil, err
 	}
+	if opt.template != "" {
+		err = in.renderTemplates(ctx, opt, src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %v", opt.template, err)
+		}
+	}
+	return src, nil
+}
+
+// fetchOne checks the policy if checkPolicy is true, and fetches the source.
+func (in *Injector) fetchOne(ctx context.Context, opt *option, checkPolicy bool) (*source, error) {
+	if checkPolicy && in.policy != nil {
+		err := in.policy.check(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return in.fetchSource(ctx, opt)
+}
 
-	src, err := in.fetchSource(opt.owner, opt.repo, opt.source, opt.branch)
+// inject fetches the source specified by opt, and updates the data and the hash annotations of sec.
+func (in *Injector) inject(ctx context.Context, sec *corev1.Secret, opt *option) error {
+	src, err := in.fetch(ctx, opt, true)
 	if err != nil {
-		in.log.Error(err, "Could not fetch source")
-		return admission.Errored(http.StatusInternalServerError, err)
+		return err
 	}
+	return in.applySource(sec, src, opt.prune)
+}
 
-	if sec.Data == nil || opt.prune {
+// applySource updates the data, the hash and the revision annotations of sec with src.
+// The data of the built-in Secret types are validated and shaped afterwards.
+// The size of the resulting data includes the keys kept from sec when prune is false.
+func (in *Injector) applySource(sec *corev1.Secret, src *source, prune bool) error {
+	if sec.Data == nil || prune {
 		sec.Data = map[string][]byte{}
 	}
+	if sec.Annotations == nil {
+		sec.Annotations = map[string]string{}
+	}
 
 	// Remove old hash annotations
 	delete(sec.Annotations, SourceHashKey)
 	for k := range sec.Annotations {
-		if strings.HasPrefix(k, SourceHashKeyPrefix) {
+		if strings.HasPrefix(k, SourceHashKeyPrefix) || strings.HasPrefix(k, TemplateHashKeyPrefix) ||
+			strings.HasPrefix(k, SourceHashKey+"-") || strings.HasPrefix(k, SourceCommitKey+"-") || strings.HasPrefix(k, SourceRefKey+"-") {
 			delete(sec.Annotations, k)
 		}
 	}
 
+	// The annotations of the additional sources are suffixed with the 1-origin indices, e.g. "hash-1".
+	annotateRevision(sec, src, "")
+	for i, overlay := range src.overlays {
+		annotateRevision(sec, overlay, fmt.Sprintf("-%d", i+1))
+	}
+	for name, hash := range src.templateHash {
+		sec.Annotations[TemplateHashKeyPrefix+name] = hash
+	}
+
 	// Update data
+	for k, v := range src.data {
+		sec.Data[k] = []byte(v)
+	}
+	err := shapeTypedSecret(sec)
+	if err != nil {
+		return err
+	}
+
+	size := 0
+	for _, v := range sec.Data {
+		size += len(v)
+	}
+	if size > in.maxSize {
+		return fmt.Errorf("the data of the Secret is %d bytes, which exceeds the maximum size %d bytes", size, in.maxSize)
+	}
+	return nil
+}
+
+// annotateRevision sets the revision and the hash annotations of src with the suffix.
+func annotateRevision(sec *corev1.Secret, src *source, suffix string) {
+	sec.Annotations[SourceCommitKey+suffix] = src.rev.commit
+	if src.rev.ref != "" {
+		sec.Annotations[SourceRefKey+suffix] = src.rev.ref
+	} else {
+		delete(sec.Annotations, SourceRefKey+suffix)
+	}
+
 	if src.srcType == typeFile {
-		sec.Annotations[SourceHashKey] = src.fileHash
-		for k, v := range src.data {
-			sec.Data[k] = []byte(v)
-		}
+		sec.Annotations[SourceHashKey+suffix] = src.fileHash
 	} else if src.srcType == typeDir {
 		for name, hash := range src.dirHash {
-			sec.Annotations[SourceHashKeyPrefix+name] = hash
-			sec.Data[name] = []byte(src.data[name])
+			sec.Annotations[SourceHashKey+suffix+"_"+name] = hash
 		}
 	}
+}
+
+// Handle handles addmission requests.
+func (in *Injector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sec := &corev1.Secret{}
+	err := in.decoder.Decode(req, sec)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if sec.Labels[WebhookTargetKey] != "true" {
+		return admission.Allowed("ok")
+	}
+
+	in.log.Info("Mutating Secrets", "namespace", req.Namespace, "name", req.Name)
+
+	opt, err := in.decodeAnnotations(sec)
+	if err != nil {
+		in.log.Error(err, "Could not decode annotations")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	opt.namespace = req.Namespace
+
+	err = in.inject(ctx, sec, opt)
+	if err != nil {
+		return in.errored(req, err, "Could not inject source")
+	}
 
 	marshaled, err := json.Marshal(sec)
 	if err != nil {
@@ -198,3 +754,14 @@ func (in *Injector) Handle(ctx context.Context, req admission.Request) admission
 	in.log.Info("Success Mutating Secrets", "namespace", req.Namespace, "name", req.Name)
 	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
 }
+
+// errored returns the response for err. deniedError denies the request, and the other errors fail it.
+func (in *Injector) errored(req admission.Request, err error, msg string) admission.Response {
+	var denied *deniedError
+	if errors.As(err, &denied) {
+		in.log.Info("Denied", "namespace", req.Namespace, "name", req.Name, "reason", denied.reason)
+		return admission.Denied(denied.reason)
+	}
+	in.log.Error(err, msg)
+	return admission.Errored(http.StatusInternalServerError, err)
+}
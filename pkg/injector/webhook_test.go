@@ -0,0 +1,45 @@
+package injector
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplySourceMaxSize(t *testing.T) {
+	in := &Injector{maxSize: 10}
+	testCases := []struct {
+		name  string
+		prune bool
+		err   bool
+	}{
+		{name: "prune", prune: true},
+		// The kept keys count towards the size of the Secret.
+		{name: "keep", prune: false, err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sec := &corev1.Secret{Data: map[string][]byte{"old": []byte("12345678")}}
+			src := &source{
+				srcType:  typeFile,
+				rev:      &revision{commit: githubTestCommit},
+				fileHash: "hash",
+				data:     map[string]string{"new": "12345678"},
+			}
+			err := in.applySource(sec, src, tc.prune)
+			if tc.err {
+				if err == nil || !strings.Contains(err.Error(), "exceeds the maximum size") {
+					t.Errorf("expected the Secret to be rejected, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sec.Data) != 1 || string(sec.Data["new"]) != "12345678" {
+				t.Errorf("expected only the new key, got %v", sec.Data)
+			}
+		})
+	}
+}